@@ -3,18 +3,23 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	logdb "github.com/dukky/toydb/log"
 	"github.com/dukky/toydb/sstable"
+	"github.com/dukky/toydb/storage"
 )
 
 // Benchmark sequential writes
 func BenchmarkLogWrites(b *testing.B) {
 	tmpDir := b.TempDir()
-	logPath := tmpDir + "/bench.log"
+	s, err := storage.NewFileStorage(tmpDir)
+	if err != nil {
+		b.Fatal(err)
+	}
 
-	db, err := logdb.NewLog(logPath)
+	db, err := logdb.NewLog(s)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -31,8 +36,12 @@ func BenchmarkLogWrites(b *testing.B) {
 
 func BenchmarkSSTableWrites(b *testing.B) {
 	tmpDir := b.TempDir()
+	s, err := storage.NewFileStorage(tmpDir)
+	if err != nil {
+		b.Fatal(err)
+	}
 
-	db, err := sstable.NewSSTableDB(tmpDir)
+	db, err := sstable.NewSSTableDB(s)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -51,9 +60,12 @@ func BenchmarkSSTableWrites(b *testing.B) {
 // Benchmark reads after writing N entries
 func benchmarkLogReads(b *testing.B, numEntries int) {
 	tmpDir := b.TempDir()
-	logPath := tmpDir + "/bench.log"
+	s, err := storage.NewFileStorage(tmpDir)
+	if err != nil {
+		b.Fatal(err)
+	}
 
-	db, err := logdb.NewLog(logPath)
+	db, err := logdb.NewLog(s)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -79,8 +91,12 @@ func benchmarkLogReads(b *testing.B, numEntries int) {
 
 func benchmarkSSTableReads(b *testing.B, numEntries int) {
 	tmpDir := b.TempDir()
+	s, err := storage.NewFileStorage(tmpDir)
+	if err != nil {
+		b.Fatal(err)
+	}
 
-	db, err := sstable.NewSSTableDB(tmpDir)
+	db, err := sstable.NewSSTableDB(s)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -110,20 +126,67 @@ func benchmarkSSTableReads(b *testing.B, numEntries int) {
 	}
 }
 
-func BenchmarkLogReads_100(b *testing.B)    { benchmarkLogReads(b, 100) }
-func BenchmarkLogReads_1000(b *testing.B)   { benchmarkLogReads(b, 1000) }
-func BenchmarkLogReads_10000(b *testing.B)  { benchmarkLogReads(b, 10000) }
+func BenchmarkLogReads_100(b *testing.B)   { benchmarkLogReads(b, 100) }
+func BenchmarkLogReads_1000(b *testing.B)  { benchmarkLogReads(b, 1000) }
+func BenchmarkLogReads_10000(b *testing.B) { benchmarkLogReads(b, 10000) }
+
+func BenchmarkSSTableReads_100(b *testing.B)   { benchmarkSSTableReads(b, 100) }
+func BenchmarkSSTableReads_1000(b *testing.B)  { benchmarkSSTableReads(b, 1000) }
+func BenchmarkSSTableReads_10000(b *testing.B) { benchmarkSSTableReads(b, 10000) }
+
+// benchmarkSSTableReadMisses measures repeated lookups for keys that don't
+// exist, which is the case the bloom filter speeds up: a filter rejection
+// answers from memory instead of reading and decompressing a block.
+func benchmarkSSTableReadMisses(b *testing.B, numEntries int, opts sstable.Options) {
+	tmpDir := b.TempDir()
+	s, err := storage.NewFileStorage(tmpDir)
+	if err != nil {
+		b.Fatal(err)
+	}
 
-func BenchmarkSSTableReads_100(b *testing.B)    { benchmarkSSTableReads(b, 100) }
-func BenchmarkSSTableReads_1000(b *testing.B)   { benchmarkSSTableReads(b, 1000) }
-func BenchmarkSSTableReads_10000(b *testing.B)  { benchmarkSSTableReads(b, 10000) }
+	db, err := sstable.NewSSTableDBWithOptions(s, opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < numEntries; i++ {
+		key := fmt.Sprintf("key%d", i)
+		value := fmt.Sprintf("value%d", i)
+		if err := db.Write(key, value); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	if err := db.Flush(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := fmt.Sprintf("missing%d", i)
+		if _, err := db.Read(key); err == nil {
+			b.Fatal("expected key not found error")
+		}
+	}
+}
+
+func BenchmarkSSTableReadMisses_FilterEnabled_10000(b *testing.B) {
+	benchmarkSSTableReadMisses(b, 10000, sstable.Options{})
+}
+func BenchmarkSSTableReadMisses_FilterDisabled_10000(b *testing.B) {
+	benchmarkSSTableReadMisses(b, 10000, sstable.Options{DisableBloomFilter: true})
+}
 
 // Benchmark mixed workload (50% reads, 50% writes)
 func BenchmarkLogMixed(b *testing.B) {
 	tmpDir := b.TempDir()
-	logPath := tmpDir + "/bench.log"
+	s, err := storage.NewFileStorage(tmpDir)
+	if err != nil {
+		b.Fatal(err)
+	}
 
-	db, err := logdb.NewLog(logPath)
+	db, err := logdb.NewLog(s)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -157,8 +220,12 @@ func BenchmarkLogMixed(b *testing.B) {
 
 func BenchmarkSSTableMixed(b *testing.B) {
 	tmpDir := b.TempDir()
+	s, err := storage.NewFileStorage(tmpDir)
+	if err != nil {
+		b.Fatal(err)
+	}
 
-	db, err := sstable.NewSSTableDB(tmpDir)
+	db, err := sstable.NewSSTableDB(s)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -197,8 +264,11 @@ func TestFileSizeComparison(t *testing.T) {
 
 	// Test Log DB
 	tmpDir1 := t.TempDir()
-	logPath := tmpDir1 + "/size_test.log"
-	logDB, err := logdb.NewLog(logPath)
+	logStorage, err := storage.NewFileStorage(tmpDir1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logDB, err := logdb.NewLog(logStorage)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -211,7 +281,7 @@ func TestFileSizeComparison(t *testing.T) {
 		}
 	}
 
-	logStat, err := os.Stat(logPath)
+	logStat, err := os.Stat(filepath.Join(tmpDir1, "log_000000.log"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -219,7 +289,11 @@ func TestFileSizeComparison(t *testing.T) {
 
 	// Test SSTable DB
 	tmpDir2 := t.TempDir()
-	sstDB, err := sstable.NewSSTableDB(tmpDir2)
+	sstStorage, err := storage.NewFileStorage(tmpDir2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sstDB, err := sstable.NewSSTableDB(sstStorage)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,163 @@
+// Package buffer implements a write-through buffer that wraps any db.DB:
+// writes and deletes land in an in-memory front up to a configured size,
+// then flush into the wrapped "back" store as a single sorted batch,
+// amortizing the back store's per-write cost (e.g. a log append) over many
+// buffered operations. It mirrors the buffered-storage pattern Camlistore's
+// sorted-kv wrappers use.
+package buffer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dukky/toydb/db"
+)
+
+// entry is one buffered write or delete, not yet flushed to back.
+type entry struct {
+	value   string
+	deleted bool
+}
+
+// Buffer implements db.DB by buffering writes in memory ahead of a back
+// db.DB. Reads check the buffered front first, so a write or delete is
+// visible immediately even before it's flushed; a buffered delete masks
+// whatever value back still has for that key.
+type Buffer struct {
+	mu       sync.Mutex
+	back     db.DB
+	maxBytes int
+
+	front map[string]entry
+	size  int // approximate size in bytes of everything buffered in front
+}
+
+// New returns a Buffer that flushes into back once its front holds at
+// least maxBytes of buffered keys and values. Call Flush to flush early,
+// e.g. before closing the database.
+func New(back db.DB, maxBytes int) *Buffer {
+	return &Buffer{
+		back:     back,
+		maxBytes: maxBytes,
+		front:    make(map[string]entry),
+	}
+}
+
+// Write buffers a key-value pair, flushing to back if this pushes the
+// front over its size threshold.
+func (b *Buffer) Write(key, value string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.put(key, entry{value: value})
+	return b.maybeFlushLocked()
+}
+
+// Delete buffers a tombstone for key, flushing to back if this pushes the
+// front over its size threshold.
+func (b *Buffer) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.put(key, entry{deleted: true})
+	return b.maybeFlushLocked()
+}
+
+// Read returns the latest value for key, checking the buffered front
+// before falling through to back.
+func (b *Buffer) Read(key string) (string, error) {
+	b.mu.Lock()
+	e, buffered := b.front[key]
+	b.mu.Unlock()
+
+	if buffered {
+		if e.deleted {
+			return "", fmt.Errorf("key not found: %s", key)
+		}
+		return e.value, nil
+	}
+
+	return b.back.Read(key)
+}
+
+// WriteBatch buffers every operation in batch, flushing to back if this
+// pushes the front over its size threshold.
+func (b *Buffer) WriteBatch(batch *db.Batch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, op := range batch.Ops() {
+		b.put(op.Key, entry{value: op.Value, deleted: op.Deleted()})
+	}
+	return b.maybeFlushLocked()
+}
+
+// Apply is a synonym for WriteBatch, matching the verb the db.DB interface
+// uses for committing a batch.
+func (b *Buffer) Apply(batch *db.Batch) error {
+	return b.WriteBatch(batch)
+}
+
+// Flush writes every buffered operation into back as a single batch, in
+// key order, then clears the front. It's a no-op if nothing is buffered.
+func (b *Buffer) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.flushLocked()
+}
+
+// put records e as key's buffered version, adjusting size for whatever it
+// replaces. Caller must hold b.mu.
+func (b *Buffer) put(key string, e entry) {
+	if old, ok := b.front[key]; ok {
+		b.size -= len(key) + len(old.value)
+	}
+	b.front[key] = e
+	b.size += len(key) + len(e.value)
+}
+
+// maybeFlushLocked flushes the front if it has reached maxBytes. Caller
+// must hold b.mu.
+func (b *Buffer) maybeFlushLocked() error {
+	if b.size < b.maxBytes {
+		return nil
+	}
+	return b.flushLocked()
+}
+
+// flushLocked is Flush's implementation. Caller must hold b.mu.
+func (b *Buffer) flushLocked() error {
+	if len(b.front) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(b.front))
+	for key := range b.front {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var batch db.Batch
+	for _, key := range keys {
+		e := b.front[key]
+		if e.deleted {
+			batch.Delete(key)
+		} else {
+			batch.Put(key, e.value)
+		}
+	}
+
+	if err := b.back.WriteBatch(&batch); err != nil {
+		return fmt.Errorf("buffer: failed to flush to back store: %w", err)
+	}
+
+	b.front = make(map[string]entry)
+	b.size = 0
+	return nil
+}
@@ -0,0 +1,130 @@
+package buffer
+
+import (
+	"testing"
+
+	"github.com/dukky/toydb/sstable"
+	"github.com/dukky/toydb/storage"
+)
+
+func TestBufferReadsBufferedWriteBeforeFlush(t *testing.T) {
+	back, err := sstable.NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create back store: %v", err)
+	}
+	defer back.Close()
+
+	buf := New(back, 1<<20)
+
+	if err := buf.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	val, err := buf.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read buffered write: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+
+	// Nothing has been flushed yet, so the back store shouldn't know about it.
+	if _, err := back.Read("key1"); err == nil {
+		t.Error("Expected back store to not yet have the unflushed write")
+	}
+}
+
+func TestBufferFlushWritesToBack(t *testing.T) {
+	back, err := sstable.NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create back store: %v", err)
+	}
+	defer back.Close()
+
+	buf := New(back, 1<<20)
+
+	if err := buf.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := buf.Write("key2", "value2"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	if err := buf.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	val, err := back.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read flushed key1 from back store: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+
+	val, err = back.Read("key2")
+	if err != nil {
+		t.Fatalf("Failed to read flushed key2 from back store: %v", err)
+	}
+	if val != "value2" {
+		t.Errorf("Expected value2, got %s", val)
+	}
+
+	// Reading through the buffer still works after a flush.
+	val, err = buf.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read key1 through buffer after flush: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+}
+
+func TestBufferDeleteMasksBackValue(t *testing.T) {
+	back, err := sstable.NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create back store: %v", err)
+	}
+	defer back.Close()
+
+	if err := back.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write to back store: %v", err)
+	}
+
+	buf := New(back, 1<<20)
+
+	if err := buf.Delete("key1"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	if _, err := buf.Read("key1"); err == nil {
+		t.Error("Expected buffered delete to mask the back store's value")
+	}
+
+	if err := buf.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	if _, err := buf.Read("key1"); err == nil {
+		t.Error("Expected key1 to still read as deleted after flush")
+	}
+}
+
+func TestBufferAutoFlushesOnSizeThreshold(t *testing.T) {
+	back, err := sstable.NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create back store: %v", err)
+	}
+	defer back.Close()
+
+	// "key1" + "value1" is 10 bytes, just over the threshold.
+	buf := New(back, 9)
+
+	if err := buf.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	if _, err := back.Read("key1"); err != nil {
+		t.Fatalf("Expected write to auto-flush past the size threshold, but back store doesn't have it: %v", err)
+	}
+}
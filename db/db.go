@@ -1,6 +1,110 @@
 package db
 
+import "fmt"
+
+// DB is the common interface implemented by every storage backend in this
+// repository.
 type DB interface {
 	Write(string, string) error
 	Read(string) (string, error)
-}
\ No newline at end of file
+	WriteBatch(*Batch) error
+	// Apply is a synonym for WriteBatch, matching the verb LevelDB-style
+	// APIs use for committing a batch.
+	Apply(*Batch) error
+}
+
+// opKind identifies the kind of operation recorded in a Batch.
+type opKind byte
+
+const (
+	opPut opKind = iota
+	opDelete
+)
+
+// Op is a single operation recorded in a Batch.
+type Op struct {
+	kind  opKind
+	Key   string
+	Value string
+}
+
+// Deleted reports whether this operation is a delete rather than a put.
+func (o Op) Deleted() bool {
+	return o.kind == opDelete
+}
+
+// Batch accumulates a sequence of Put/Delete operations to be applied to a
+// DB atomically: either every operation in the batch becomes durable, or
+// (on error) none of them do. Each backend decides how to make that true -
+// logdb and hashkv append the whole batch as a single contiguous write,
+// sstable applies it to the memtable under one lock acquisition.
+type Batch struct {
+	ops []Op
+}
+
+// Put appends a Put operation to the batch.
+func (b *Batch) Put(key, value string) {
+	b.ops = append(b.ops, Op{kind: opPut, Key: key, Value: value})
+}
+
+// Delete appends a Delete operation to the batch.
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, Op{kind: opDelete, Key: key})
+}
+
+// Len returns the number of operations recorded in the batch.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Count is a synonym for Len, matching the verb LevelDB-style batch APIs
+// use for the number of operations recorded so far.
+func (b *Batch) Count() int {
+	return b.Len()
+}
+
+// Reset clears the batch so it can be reused.
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// Ops returns the recorded operations, in the order they were added.
+func (b *Batch) Ops() []Op {
+	return b.ops
+}
+
+// BatchReplay is implemented by anything a decoded batch can be re-applied
+// to - a DB, a memtable, an in-memory index - so recovery code can replay a
+// durable batch record without depending on a specific backend's internals.
+type BatchReplay interface {
+	Write(key, value string) error
+	Delete(key string) error
+}
+
+// Replay applies every operation in the batch to r, in order, stopping at
+// the first error.
+func (b *Batch) Replay(r BatchReplay) error {
+	for _, op := range b.ops {
+		var err error
+		if op.Deleted() {
+			err = r.Delete(op.Key)
+		} else {
+			err = r.Write(op.Key, op.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrBatchCorrupted is returned when a batch record on disk can't be
+// decoded, e.g. because its header's operation count doesn't match the
+// records actually present.
+type ErrBatchCorrupted struct {
+	Reason string
+}
+
+func (e *ErrBatchCorrupted) Error() string {
+	return fmt.Sprintf("batch corrupted: %s", e.Reason)
+}
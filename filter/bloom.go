@@ -0,0 +1,126 @@
+// Package filter implements a bloom filter tuned for SSTable point lookups:
+// given bitsPerKey (default 10, for a ~1% false positive rate), it lets a
+// reader skip an entire block read for a key that definitely isn't present.
+package filter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// DefaultBitsPerKey gives a false positive rate of about 1%.
+const DefaultBitsPerKey = 10
+
+// BloomFilter is a fixed-size bit array queried with k independently-seeded
+// hash probes derived from two base hashes (the "double hashing" trick:
+// h_i = h1 + i*h2), avoiding the cost of k independent hash functions.
+type BloomFilter struct {
+	bits []byte
+	k    int
+}
+
+// New builds a bloom filter sized for len(keys) entries at bitsPerKey bits
+// per key, then adds every key in keys to it.
+func New(keys []string, bitsPerKey int) *BloomFilter {
+	if bitsPerKey <= 0 {
+		bitsPerKey = DefaultBitsPerKey
+	}
+
+	numBits := len(keys) * bitsPerKey
+	if numBits < 64 {
+		numBits = 64
+	}
+	// Round up to a whole number of bytes.
+	numBytes := (numBits + 7) / 8
+	numBits = numBytes * 8
+
+	k := int(math.Round(float64(bitsPerKey) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	if k > 30 {
+		k = 30
+	}
+
+	f := &BloomFilter{bits: make([]byte, numBytes), k: k}
+	for _, key := range keys {
+		f.Add(key)
+	}
+	return f
+}
+
+// Add records key in the filter.
+func (f *BloomFilter) Add(key string) {
+	h1, h2 := baseHashes(key)
+	numBits := uint32(len(f.bits) * 8)
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint32(i)*h2) % numBits
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// MayContain reports whether key might be present. A false return means key
+// is definitely absent; a true return means key is present with high
+// probability (subject to the filter's false positive rate).
+func (f *BloomFilter) MayContain(key string) bool {
+	if len(f.bits) == 0 {
+		return true
+	}
+	h1, h2 := baseHashes(key)
+	numBits := uint32(len(f.bits) * 8)
+	for i := 0; i < f.k; i++ {
+		bit := (h1 + uint32(i)*h2) % numBits
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// baseHashes derives the two independent hashes that double hashing
+// combines into k probe positions, using FNV-1a with and without an extra
+// seed byte.
+func baseHashes(key string) (uint32, uint32) {
+	h1 := fnv.New32a()
+	h1.Write([]byte(key))
+	sum1 := h1.Sum32()
+
+	h2 := fnv.New32a()
+	h2.Write([]byte(key))
+	h2.Write([]byte{0xff})
+	sum2 := h2.Sum32()
+	if sum2 == 0 {
+		sum2 = 1 // a zero second hash would collapse every probe onto h1.
+	}
+
+	return sum1, sum2
+}
+
+// Encode serializes the filter as a 1-byte k followed by the bit array, so
+// it can be written as an SSTable block.
+func (f *BloomFilter) Encode() []byte {
+	encoded := make([]byte, 1+len(f.bits))
+	encoded[0] = byte(f.k)
+	copy(encoded[1:], f.bits)
+	return encoded
+}
+
+// Decode is the inverse of Encode.
+func Decode(data []byte) (*BloomFilter, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("filter: encoded filter too short")
+	}
+	return &BloomFilter{k: int(data[0]), bits: data[1:]}, nil
+}
+
+// EncodedLen returns the number of bytes Encode would produce for a filter
+// over numKeys keys at bitsPerKey bits per key; callers can use it to size
+// buffers without building the filter first.
+func EncodedLen(numKeys, bitsPerKey int) int {
+	numBits := numKeys * bitsPerKey
+	if numBits < 64 {
+		numBits = 64
+	}
+	return 1 + (numBits+7)/8
+}
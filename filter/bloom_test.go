@@ -0,0 +1,58 @@
+package filter
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	keys := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+
+	bf := New(keys, DefaultBitsPerKey)
+
+	for _, key := range keys {
+		if !bf.MayContain(key) {
+			t.Fatalf("MayContain(%q) = false, want true (false negatives are not allowed)", key)
+		}
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	keys := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+
+	bf := New(keys, DefaultBitsPerKey)
+
+	falsePositives := 0
+	const numAbsent = 10000
+	for i := 0; i < numAbsent; i++ {
+		if bf.MayContain(fmt.Sprintf("absent-%d", i)) {
+			falsePositives++
+		}
+	}
+
+	rate := float64(falsePositives) / float64(numAbsent)
+	if rate > 0.05 {
+		t.Fatalf("false positive rate too high: %.4f (%d/%d)", rate, falsePositives, numAbsent)
+	}
+}
+
+func TestBloomFilterEncodeDecode(t *testing.T) {
+	bf := New([]string{"apple", "banana", "cherry"}, DefaultBitsPerKey)
+
+	decoded, err := Decode(bf.Encode())
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	for _, key := range []string{"apple", "banana", "cherry"} {
+		if !decoded.MayContain(key) {
+			t.Errorf("decoded filter lost key %q", key)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"log"
 	"os"
+
+	"github.com/dukky/toydb/db"
 )
 
 type HashKVEntry struct {
@@ -15,9 +17,27 @@ type HashKVEntry struct {
 	Deleted bool   `json:"deleted"`
 }
 
+// batchRecord is one operation within an on-disk batchPayload.
+type batchRecord struct {
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// batchPayload is the on-disk representation of a Batch: a header carrying a
+// sequence number and record count, followed by the records themselves. It
+// is written as a single length-prefixed record, the same framing used for
+// a single HashKVEntry.
+type batchPayload struct {
+	Seq     uint64        `json:"seq"`
+	Count   int           `json:"count"`
+	Records []batchRecord `json:"records"`
+}
+
 type HashKV struct {
 	logPath         string
 	byteOffsetIndex map[string]int64
+	nextSeq         uint64
 }
 
 func (h *HashKV) Write(key string, value string) error {
@@ -91,6 +111,25 @@ func (h *HashKV) Read(key string) (string, error) {
 		return entry.Value, nil
 	}
 
+	// Try to unmarshal as a batch record written by WriteBatch.
+	var batch batchPayload
+	if err := json.Unmarshal(data, &batch); err == nil && batch.Count > 0 {
+		if len(batch.Records) != batch.Count {
+			return "", &db.ErrBatchCorrupted{Reason: fmt.Sprintf("batch at offset %d declares %d records but has %d", offset, batch.Count, len(batch.Records))}
+		}
+		// The last record for key in the batch wins, as in the index.
+		for i := len(batch.Records) - 1; i >= 0; i-- {
+			rec := batch.Records[i]
+			if rec.Key == key {
+				if rec.Deleted {
+					return "", fmt.Errorf("key not found")
+				}
+				return rec.Value, nil
+			}
+		}
+		return "", &db.ErrBatchCorrupted{Reason: fmt.Sprintf("key %q not present in batch record at offset %d", key, offset)}
+	}
+
 	// Fall back to old format: {"key":"value"}
 	var oldFormat map[string]string
 	if err := json.Unmarshal(data, &oldFormat); err != nil {
@@ -146,6 +185,69 @@ func (h *HashKV) Delete(key string) error {
 	return nil
 }
 
+// WriteBatch appends every operation in batch as a single length-prefixed
+// record, so a crash either sees the whole batch or none of it. The index
+// is only updated once that record is on disk, so a torn write never makes
+// part of a batch visible.
+func (h *HashKV) WriteBatch(batch *db.Batch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	records := make([]batchRecord, 0, batch.Len())
+	for _, op := range batch.Ops() {
+		records = append(records, batchRecord{Key: op.Key, Value: op.Value, Deleted: op.Deleted()})
+	}
+
+	h.nextSeq++
+	payload := batchPayload{Seq: h.nextSeq, Count: len(records), Records: records}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshalling batch: %v", err)
+	}
+
+	file, err := os.OpenFile(h.logPath, os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening logPath: %v", err)
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("error seeking to end: %v", err)
+	}
+
+	length := int64(len(payloadBytes))
+	if err := binary.Write(file, binary.LittleEndian, length); err != nil {
+		return fmt.Errorf("error writing length: %v", err)
+	}
+	if err := binary.Write(file, binary.LittleEndian, payloadBytes); err != nil {
+		return fmt.Errorf("error writing batch: %v", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing file: %v", err)
+	}
+
+	// Only now that the whole batch is durable do we update the index, and
+	// we do it for every record so a batch is never partially visible.
+	for _, rec := range records {
+		if rec.Deleted {
+			delete(h.byteOffsetIndex, rec.Key)
+		} else {
+			h.byteOffsetIndex[rec.Key] = offset
+		}
+	}
+
+	return nil
+}
+
+// Apply is a synonym for WriteBatch, matching the verb the db.DB interface
+// uses for committing a batch.
+func (h *HashKV) Apply(batch *db.Batch) error {
+	return h.WriteBatch(batch)
+}
+
 func NewHashKV(logPath string) *HashKV {
 	hashKV := &HashKV{
 		logPath:         logPath,
@@ -212,6 +314,22 @@ func NewHashKV(logPath string) *HashKV {
 			continue
 		}
 
+		// Try to unmarshal as a batch record; every key it touches points
+		// back at the start of the batch.
+		var batch batchPayload
+		if err := json.Unmarshal(data, &batch); err == nil && batch.Count > 0 && len(batch.Records) == batch.Count {
+			for _, rec := range batch.Records {
+				latestEntries[rec.Key] = struct {
+					position int64
+					deleted  bool
+				}{position: pos, deleted: rec.Deleted}
+			}
+			if batch.Seq > hashKV.nextSeq {
+				hashKV.nextSeq = batch.Seq
+			}
+			continue
+		}
+
 		// Fall back to old format: {"key":"value"}
 		unmarshalled := make(map[string]any)
 		err = json.Unmarshal(data, &unmarshalled)
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/dukky/toydb/db"
 )
 
 func TestBasicDeleteOperation(t *testing.T) {
@@ -248,6 +250,59 @@ func TestDeleteNonExistentKey(t *testing.T) {
 	}
 }
 
+func TestWriteBatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.db")
+
+	kv := NewHashKV(logPath)
+
+	if err := kv.Write("existing", "before"); err != nil {
+		t.Fatalf("Failed to seed key: %v", err)
+	}
+
+	var batch db.Batch
+	batch.Put("key1", "value1")
+	batch.Put("key2", "value2")
+	batch.Delete("existing")
+
+	if err := kv.WriteBatch(&batch); err != nil {
+		t.Fatalf("Failed to write batch: %v", err)
+	}
+
+	value, err := kv.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read key1: %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("Expected 'value1', got '%s'", value)
+	}
+
+	value, err = kv.Read("key2")
+	if err != nil {
+		t.Fatalf("Failed to read key2: %v", err)
+	}
+	if value != "value2" {
+		t.Errorf("Expected 'value2', got '%s'", value)
+	}
+
+	if _, err := kv.Read("existing"); err == nil {
+		t.Error("Expected error reading key deleted via batch")
+	}
+
+	// The batch record must also survive an index rebuild.
+	kv2 := NewHashKV(logPath)
+	value, err = kv2.Read("key2")
+	if err != nil {
+		t.Fatalf("Failed to read key2 after rebuild: %v", err)
+	}
+	if value != "value2" {
+		t.Errorf("Expected 'value2' after rebuild, got '%s'", value)
+	}
+	if _, err := kv2.Read("existing"); err == nil {
+		t.Error("Expected error reading batch-deleted key after rebuild")
+	}
+}
+
 func TestTombstoneFormatInFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	logPath := filepath.Join(tmpDir, "test.db")
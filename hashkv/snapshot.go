@@ -0,0 +1,100 @@
+package hashkv
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Snapshot is a point-in-time, read-only view of a HashKV: it pins the
+// length of the log file in effect when it was taken, so records appended
+// afterwards stay invisible to it. Because HashKV's log is append-only and
+// never compacted, the byte watermark alone is enough to reconstruct the
+// state as of the snapshot - there's no garbage collection that could drop
+// a version a snapshot still needs, unlike sstable.Snapshot.
+type Snapshot struct {
+	h      *HashKV
+	length int64
+}
+
+// GetSnapshot returns a Snapshot pinned to the HashKV's current log length.
+func (h *HashKV) GetSnapshot() (*Snapshot, error) {
+	info, err := os.Stat(h.logPath)
+	if err != nil {
+		return nil, fmt.Errorf("error statting logPath: %v", err)
+	}
+	return &Snapshot{h: h, length: info.Size()}, nil
+}
+
+// Get reads the value of key as of the snapshot's log length, ignoring any
+// record appended after the snapshot was taken.
+func (s *Snapshot) Get(key string) (string, error) {
+	file, err := os.Open(s.h.logPath)
+	if err != nil {
+		return "", fmt.Errorf("error opening logPath: %v", err)
+	}
+	defer file.Close()
+
+	found := false
+	deleted := false
+	value := ""
+
+	for {
+		pos, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return "", fmt.Errorf("error seeking: %v", err)
+		}
+		if pos >= s.length {
+			break
+		}
+
+		length := int64(0)
+		if err := binary.Read(file, binary.LittleEndian, &length); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", fmt.Errorf("error reading length: %v", err)
+		}
+
+		data := make([]byte, length)
+		if err := binary.Read(file, binary.LittleEndian, &data); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", fmt.Errorf("error reading data: %v", err)
+		}
+
+		var entry HashKVEntry
+		if err := json.Unmarshal(data, &entry); err == nil && entry.Key != "" {
+			if entry.Key == key {
+				found = true
+				deleted = entry.Deleted
+				value = entry.Value
+			}
+			continue
+		}
+
+		var batch batchPayload
+		if err := json.Unmarshal(data, &batch); err == nil && batch.Count > 0 && len(batch.Records) == batch.Count {
+			for _, rec := range batch.Records {
+				if rec.Key == key {
+					found = true
+					deleted = rec.Deleted
+					value = rec.Value
+				}
+			}
+		}
+	}
+
+	if !found || deleted {
+		return "", fmt.Errorf("key not found")
+	}
+	return value, nil
+}
+
+// Release is a no-op: since HashKV never compacts its log, a Snapshot holds
+// no resources that need to be freed. It exists so callers can treat every
+// backend's snapshot the same way.
+func (s *Snapshot) Release() {}
@@ -0,0 +1,84 @@
+package hashkv
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotIsolatesLaterWrites(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.db")
+
+	db := NewHashKV(logPath)
+
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("GetSnapshot failed: %v", err)
+	}
+	defer snap.Release()
+
+	if err := db.Write("key1", "value2"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := db.Write("key2", "value2"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	val, err := snap.Get("key1")
+	if err != nil {
+		t.Fatalf("snapshot Get failed: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected snapshot to see value1, got %s", val)
+	}
+
+	if _, err := snap.Get("key2"); err == nil {
+		t.Error("Expected error reading key written after the snapshot was taken")
+	}
+
+	// The live database sees the later writes.
+	val, err = db.Read("key1")
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if val != "value2" {
+		t.Errorf("Expected db.Read to see value2, got %s", val)
+	}
+}
+
+func TestSnapshotSeesDeleteAfterIt(t *testing.T) {
+	tmpDir := t.TempDir()
+	logPath := filepath.Join(tmpDir, "test.db")
+
+	db := NewHashKV(logPath)
+
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("GetSnapshot failed: %v", err)
+	}
+	defer snap.Release()
+
+	if err := db.Delete("key1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	val, err := snap.Get("key1")
+	if err != nil {
+		t.Fatalf("Expected snapshot to still see key1: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+
+	if _, err := db.Read("key1"); err == nil {
+		t.Error("Expected error reading deleted key from the live database")
+	}
+}
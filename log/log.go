@@ -2,52 +2,98 @@ package logdb
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
-	"os"
+	"io"
+
+	"github.com/dukky/toydb/db"
+	"github.com/dukky/toydb/storage"
 )
 
+// logFileDesc is the FileDesc of a Log's single append-only file. There is
+// only ever one, so it always uses Num 0.
+var logFileDesc = storage.FileDesc{Type: storage.TypeLog, Num: 0}
+
 type Log struct {
-	LogPath string
+	storage storage.Storage
+	lock    storage.Releaser
 }
 
 type Entry struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Deleted bool   `json:"deleted,omitempty"`
 }
 
 func (l *Log) Write(key string, value string) error {
-	file, err := os.OpenFile(l.LogPath, os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
-	}
-	defer file.Close()
-	marshalled, err := json.Marshal(Entry{
-		Key:   key,
-		Value: value,
-	})
+	return l.append(Entry{Key: key, Value: value})
+}
+
+// Delete appends a tombstone for key so that subsequent reads treat it as
+// missing, until compaction drops it for good.
+func (l *Log) Delete(key string) error {
+	return l.append(Entry{Key: key, Deleted: true})
+}
+
+// append writes entry as the next line in the log, via storage.Append so
+// already-durable entries are never at risk from this write.
+func (l *Log) append(entry Entry) error {
+	marshalled, err := json.Marshal(entry)
 	if err != nil {
 		return fmt.Errorf("error marshalling json: %v", err)
 	}
-
 	marshalled = append(marshalled, '\n')
-	_, err = file.Write(marshalled)
+
+	file, err := l.storage.Append(logFileDesc)
 	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(marshalled); err != nil {
 		return fmt.Errorf("error writing data: %v", err)
 	}
 
 	return nil
 }
 
+// readRaw returns the log's current raw contents, or nil if it doesn't
+// exist yet.
+func (l *Log) readRaw() ([]byte, error) {
+	reader, err := l.storage.Open(logFileDesc)
+	if err != nil {
+		return nil, nil
+	}
+	defer reader.Close()
+
+	size, err := reader.Size()
+	if err != nil {
+		return nil, fmt.Errorf("error statting file: %v", err)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(reader, 0, size), buf); err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	return buf, nil
+}
+
 func (l *Log) Read(key string) (string, error) {
-	file, err := os.Open(l.LogPath)
+	reader, err := l.storage.Open(logFileDesc)
 	if err != nil {
 		return "", fmt.Errorf("error opening file: %v", err)
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
+	defer reader.Close()
+
+	size, err := reader.Size()
+	if err != nil {
+		return "", fmt.Errorf("error statting file: %v", err)
+	}
+
+	scanner := bufio.NewScanner(io.NewSectionReader(reader, 0, size))
 	latest := ""
+	found := false
+	deleted := false
 	for scanner.Scan() {
 		var entry Entry
 		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
@@ -55,62 +101,125 @@ func (l *Log) Read(key string) (string, error) {
 		}
 		if entry.Key == key {
 			latest = entry.Value
+			found = true
+			deleted = entry.Deleted
 		}
 	}
+	if found && deleted {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
 	return latest, nil
 }
 
-func NewLog(logPath string) *Log {
-	db := &Log{
-		LogPath: logPath,
+// WriteBatch appends every operation in batch as a single contiguous write,
+// so a crash either sees all of them or none of them.
+func (l *Log) WriteBatch(batch *db.Batch) error {
+	if batch.Len() == 0 {
+		return nil
 	}
-	_, err := os.Stat(logPath)
-	if os.IsNotExist(err) {
-		file, err := os.Create(logPath)
+
+	var buf bytes.Buffer
+	for _, op := range batch.Ops() {
+		entry := Entry{Key: op.Key, Value: op.Value, Deleted: op.Deleted()}
+		marshalled, err := json.Marshal(entry)
 		if err != nil {
-			log.Fatal(err)
+			return fmt.Errorf("error marshalling batch entry: %v", err)
 		}
-		defer file.Close()
+		buf.Write(marshalled)
+		buf.WriteByte('\n')
+	}
 
-		return db
+	file, err := l.storage.Append(logFileDesc)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
 	}
-	if err = compact(db); err != nil {
-		log.Fatal(err)
+	defer file.Close()
+
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing batch: %v", err)
 	}
-	return db
+
+	return nil
+}
+
+// Apply is a synonym for WriteBatch, matching the verb the db.DB interface
+// uses for committing a batch.
+func (l *Log) Apply(batch *db.Batch) error {
+	return l.WriteBatch(batch)
+}
+
+// NewLog returns a Log backed by s, compacting its existing log file (if
+// any) to collapse duplicate keys down to their latest value. It holds
+// s's Lock for as long as the Log is open, so a second Log can't open the
+// same storage underneath it and corrupt its file; Close releases it.
+func NewLog(s storage.Storage) (*Log, error) {
+	lock, err := s.Lock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock storage: %w", err)
+	}
+
+	l := &Log{storage: s, lock: lock}
+
+	if _, err := s.Open(logFileDesc); err != nil {
+		file, err := s.Create(logFileDesc)
+		if err != nil {
+			lock.Release()
+			return nil, fmt.Errorf("error creating file: %v", err)
+		}
+		file.Close()
+		return l, nil
+	}
+
+	if err := compact(l); err != nil {
+		lock.Release()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Close releases the lock acquired by NewLog, allowing another Log to open
+// the same storage.
+func (l *Log) Close() error {
+	return l.lock.Release()
 }
 
 func compact(l *Log) error {
-	readFile, err := os.Open(l.LogPath)
+	raw, err := l.readRaw()
 	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
+		return err
 	}
-	defer readFile.Close()
-	scanner := bufio.NewScanner(readFile)
-	seen := make(map[string]string)
+
+	seen := make(map[string]Entry)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
 	for scanner.Scan() {
 		var entry Entry
 		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
 			return fmt.Errorf("error unmarshalling json: %v", err)
 		}
-		seen[entry.Key] = entry.Value
+		seen[entry.Key] = entry
 	}
-	writeFile, err := os.Create(l.LogPath)
+
+	file, err := l.storage.Create(logFileDesc)
 	if err != nil {
-		return err
+		return fmt.Errorf("error opening file: %v", err)
 	}
-	defer writeFile.Close()
-	for k, v := range seen {
-		entry, err := json.Marshal(Entry{
+	defer file.Close()
+
+	for k, entry := range seen {
+		// Deleted keys are dropped entirely: after compaction a tombstoned
+		// key reads back exactly like one that was never written.
+		if entry.Deleted {
+			continue
+		}
+		marshalled, err := json.Marshal(Entry{
 			Key:   k,
-			Value: v,
+			Value: entry.Value,
 		})
 		if err != nil {
 			return fmt.Errorf("error marshalling json: %v", err)
 		}
-		entry = append(entry, '\n')
-		_, err = writeFile.Write(entry)
-		if err != nil {
+		marshalled = append(marshalled, '\n')
+		if _, err := file.Write(marshalled); err != nil {
 			return fmt.Errorf("error writing data: %v", err)
 		}
 	}
@@ -1,8 +1,10 @@
 package logdb
 
 import (
-	"os"
 	"testing"
+
+	"github.com/dukky/toydb/db"
+	"github.com/dukky/toydb/storage"
 )
 
 // TestCompactDuplicateKeys tests that compaction keeps only the latest value for duplicate keys.
@@ -10,14 +12,15 @@ import (
 // exact duplicate lines. This means writing the same key with different values results in BOTH
 // entries being kept instead of just the latest one.
 func TestCompactDuplicateKeys(t *testing.T) {
-	// Create a temporary test file
-	tmpFile := "test_compact_duplicate.bin"
-	defer os.Remove(tmpFile)
+	s := storage.NewMemStorage()
 
 	// Create a new log and write the same key twice with different values
-	log := NewLog(tmpFile)
+	log, err := NewLog(s)
+	if err != nil {
+		t.Fatalf("Failed to create log: %v", err)
+	}
 
-	err := log.Write("test_key", "first_value")
+	err = log.Write("test_key", "first_value")
 	if err != nil {
 		t.Fatalf("Failed to write first value: %v", err)
 	}
@@ -27,8 +30,14 @@ func TestCompactDuplicateKeys(t *testing.T) {
 		t.Fatalf("Failed to write second value: %v", err)
 	}
 
-	// Now create a new Log instance, which will trigger compaction
-	log = NewLog(tmpFile)
+	// Now create a new Log instance, which will trigger compaction.
+	if err := log.Close(); err != nil {
+		t.Fatalf("Failed to close log: %v", err)
+	}
+	log, err = NewLog(s)
+	if err != nil {
+		t.Fatalf("Failed to reopen log: %v", err)
+	}
 
 	// Read the value - should only get the latest value
 	value, err := log.Read("test_key")
@@ -41,18 +50,11 @@ func TestCompactDuplicateKeys(t *testing.T) {
 		t.Errorf("Expected 'second_value', got '%s'. The compact function should keep only the latest value for each key.", value)
 	}
 
-	// Additional check: verify the file only has one line (the compacted result)
+	// Additional check: verify the log only has one line (the compacted result).
 	// If compact worked correctly, there should only be one entry for "test_key"
-	file, err := os.Open(tmpFile)
+	content, err := log.readRaw()
 	if err != nil {
-		t.Fatalf("Failed to open file: %v", err)
-	}
-	defer file.Close()
-
-	// Count lines in the file
-	content, err := os.ReadFile(tmpFile)
-	if err != nil {
-		t.Fatalf("Failed to read file: %v", err)
+		t.Fatalf("Failed to read log contents: %v", err)
 	}
 
 	lines := 0
@@ -67,3 +69,40 @@ func TestCompactDuplicateKeys(t *testing.T) {
 		t.Errorf("Expected 1 line after compaction, got %d. The compact function should deduplicate by key, not by line.", lines)
 	}
 }
+
+// TestWriteBatch verifies that a batch of puts and deletes is applied as a
+// unit and is visible to reads afterwards.
+func TestWriteBatch(t *testing.T) {
+	log, err := NewLog(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create log: %v", err)
+	}
+
+	if err := log.Write("existing", "before"); err != nil {
+		t.Fatalf("Failed to seed key: %v", err)
+	}
+
+	var batch db.Batch
+	batch.Put("batch_key", "batch_value")
+	batch.Delete("existing")
+
+	if batch.Len() != 2 {
+		t.Fatalf("Expected batch length 2, got %d", batch.Len())
+	}
+
+	if err := log.WriteBatch(&batch); err != nil {
+		t.Fatalf("Failed to write batch: %v", err)
+	}
+
+	value, err := log.Read("batch_key")
+	if err != nil {
+		t.Fatalf("Failed to read batch_key: %v", err)
+	}
+	if value != "batch_value" {
+		t.Errorf("Expected 'batch_value', got '%s'", value)
+	}
+
+	if _, err := log.Read("existing"); err == nil {
+		t.Error("Expected error reading key deleted via batch")
+	}
+}
@@ -2,11 +2,21 @@ package main
 
 import (
 	"github.com/dukky/toydb/db"
-	"github.com/dukky/toydb/log"
+	logdb "github.com/dukky/toydb/log"
+	"github.com/dukky/toydb/storage"
 )
 
 func main() {
-	var db db.DB = log.NewLog("test.log")
+	s, err := storage.NewFileStorage("test_data")
+	if err != nil {
+		panic(err)
+	}
+
+	var db db.DB
+	db, err = logdb.NewLog(s)
+	if err != nil {
+		panic(err)
+	}
 
 	db.Write("Hello", "world")
 	db.Write("Goodbye", "world")
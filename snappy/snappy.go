@@ -0,0 +1,212 @@
+// Package snappy implements the raw Snappy block format (as used by
+// LevelDB's table format) using only the standard library, so sstable can
+// compress its data blocks without pulling in a third-party dependency.
+//
+// The format is: a varint-encoded uncompressed length, followed by a
+// sequence of elements that are either literal runs or back-references
+// ("copies") into the already-decoded output. See
+// https://github.com/google/snappy/blob/main/format_description.txt for the
+// full spec; this package implements the subset needed to round-trip data
+// written by Encode.
+package snappy
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+
+	maxOffset    = 1 << 32
+	minMatchLen  = 4
+	maxMatchLen  = 64
+	hashTableLen = 1 << 14
+)
+
+// MaxEncodedLen returns an upper bound on the encoded size of a block of n
+// uncompressed bytes.
+func MaxEncodedLen(n int) int {
+	return binary.MaxVarintLen64 + n + n/6 + 32
+}
+
+// Encode compresses src and returns the encoded bytes. Incompressible input
+// grows by one tag byte per 60-byte literal chunk plus the length preamble.
+func Encode(src []byte) []byte {
+	dst := make([]byte, 0, MaxEncodedLen(len(src)))
+
+	var varintBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(varintBuf[:], uint64(len(src)))
+	dst = append(dst, varintBuf[:n]...)
+
+	if len(src) == 0 {
+		return dst
+	}
+
+	// hashTable maps a hash of 4 bytes to the most recent position in src
+	// where that 4-byte sequence started. 0 means "no entry" (we bias real
+	// positions by 1 so the zero value stays reserved).
+	var hashTable [hashTableLen]int32
+
+	literalStart := 0
+	i := 0
+	for i+minMatchLen <= len(src) {
+		h := hash4(src[i:]) % hashTableLen
+		candidate := int(hashTable[h]) - 1
+		hashTable[h] = int32(i + 1)
+
+		if candidate < 0 || i-candidate > maxOffset || !matches4(src, candidate, i) {
+			i++
+			continue
+		}
+
+		// Extend the match as far as it goes.
+		matchLen := 4
+		for i+matchLen < len(src) && matchLen < maxMatchLen && src[candidate+matchLen] == src[i+matchLen] {
+			matchLen++
+		}
+
+		if literalStart < i {
+			dst = appendLiteral(dst, src[literalStart:i])
+		}
+		dst = appendCopy(dst, i-candidate, matchLen)
+
+		i += matchLen
+		literalStart = i
+	}
+
+	if literalStart < len(src) {
+		dst = appendLiteral(dst, src[literalStart:])
+	}
+
+	return dst
+}
+
+// Decode decodes src (as produced by Encode) and returns the original
+// bytes.
+func Decode(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, fmt.Errorf("snappy: invalid or missing length preamble")
+	}
+	src = src[n:]
+
+	dst := make([]byte, 0, length)
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 0x03 {
+		case tagLiteral:
+			litLen := int(tag>>2) + 1
+			src = src[1:]
+			if litLen > len(src) {
+				return nil, fmt.Errorf("snappy: literal length %d exceeds remaining input", litLen)
+			}
+			dst = append(dst, src[:litLen]...)
+			src = src[litLen:]
+		case tagCopy1:
+			if len(src) < 2 {
+				return nil, fmt.Errorf("snappy: truncated 1-byte copy tag")
+			}
+			copyLen := int((tag>>2)&0x07) + 4
+			offset := (int(tag>>5) << 8) | int(src[1])
+			src = src[2:]
+			var err error
+			if dst, err = expandCopy(dst, offset, copyLen); err != nil {
+				return nil, err
+			}
+		case tagCopy2:
+			if len(src) < 3 {
+				return nil, fmt.Errorf("snappy: truncated 2-byte copy tag")
+			}
+			copyLen := int(tag>>2) + 1
+			offset := int(binary.LittleEndian.Uint16(src[1:3]))
+			src = src[3:]
+			var err error
+			if dst, err = expandCopy(dst, offset, copyLen); err != nil {
+				return nil, err
+			}
+		case tagCopy4:
+			if len(src) < 5 {
+				return nil, fmt.Errorf("snappy: truncated 4-byte copy tag")
+			}
+			copyLen := int(tag>>2) + 1
+			offset := int(binary.LittleEndian.Uint32(src[1:5]))
+			src = src[5:]
+			var err error
+			if dst, err = expandCopy(dst, offset, copyLen); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if uint64(len(dst)) != length {
+		return nil, fmt.Errorf("snappy: decoded length %d does not match preamble %d", len(dst), length)
+	}
+
+	return dst, nil
+}
+
+func hash4(b []byte) uint32 {
+	v := binary.LittleEndian.Uint32(b)
+	return (v * 2654435761) >> 16
+}
+
+func matches4(src []byte, a, b int) bool {
+	return src[a] == src[b] && src[a+1] == src[b+1] && src[a+2] == src[b+2] && src[a+3] == src[b+3]
+}
+
+// expandCopy appends length bytes to dst, copied from offset bytes before
+// the current end of dst. Ranges may overlap (e.g. offset=1 run-length
+// encodes a repeated byte), so this copies one byte at a time rather than
+// using copy().
+func expandCopy(dst []byte, offset, length int) ([]byte, error) {
+	if offset <= 0 || offset > len(dst) {
+		return nil, fmt.Errorf("snappy: copy offset %d out of range (dst len %d)", offset, len(dst))
+	}
+	start := len(dst) - offset
+	for i := 0; i < length; i++ {
+		dst = append(dst, dst[start+i])
+	}
+	return dst, nil
+}
+
+// appendLiteral appends a literal element for lit, splitting it into chunks
+// of at most 60 bytes since that's all a single-byte literal tag can hold
+// (tag values 60-63 mean the length follows in extra bytes).
+func appendLiteral(dst []byte, lit []byte) []byte {
+	for len(lit) > 0 {
+		n := len(lit)
+		if n > 60 {
+			n = 60
+		}
+		dst = append(dst, byte(n-1)<<2|tagLiteral)
+		dst = append(dst, lit[:n]...)
+		lit = lit[n:]
+	}
+	return dst
+}
+
+// appendCopy appends a copy element referring back offset bytes for length
+// bytes, splitting it into chunks the fixed-width tags can represent.
+func appendCopy(dst []byte, offset, length int) []byte {
+	for length > 0 {
+		n := length
+		if n > maxMatchLen {
+			n = maxMatchLen
+		}
+		switch {
+		case n <= 11 && offset < 1<<11:
+			dst = append(dst, byte(offset>>8)<<5|byte(n-4)<<2|tagCopy1, byte(offset))
+		case offset < 1<<16:
+			dst = append(dst, byte(n-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+		default:
+			dst = append(dst, byte(n-1)<<2|tagCopy4,
+				byte(offset), byte(offset>>8), byte(offset>>16), byte(offset>>24))
+		}
+		length -= n
+	}
+	return dst
+}
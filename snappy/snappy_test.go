@@ -0,0 +1,55 @@
+package snappy
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	cases := []string{
+		"",
+		"a",
+		"hello world",
+		strings.Repeat("ab", 100),
+		strings.Repeat("x", 1000),
+	}
+
+	for _, in := range cases {
+		encoded := Encode([]byte(in))
+		decoded, err := Decode(encoded)
+		if err != nil {
+			t.Fatalf("Decode failed for %q: %v", in, err)
+		}
+		if !bytes.Equal(decoded, []byte(in)) {
+			t.Errorf("Round trip mismatch for %q: got %q", in, decoded)
+		}
+	}
+}
+
+func TestEncodeDecodeRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		n := r.Intn(4096)
+		data := make([]byte, n)
+		r.Read(data)
+
+		encoded := Encode(data)
+		decoded, err := Decode(encoded)
+		if err != nil {
+			t.Fatalf("Decode failed for random input of length %d: %v", n, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("Round trip mismatch for random input of length %d", n)
+		}
+	}
+}
+
+func TestEncodeCompressesRepetitiveData(t *testing.T) {
+	data := []byte(strings.Repeat("the quick brown fox ", 200))
+	encoded := Encode(data)
+	if len(encoded) >= len(data) {
+		t.Errorf("Expected repetitive data to compress, got %d bytes in, %d bytes out", len(data), len(encoded))
+	}
+}
@@ -0,0 +1,230 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// encodeBlock serializes entries (already sorted by key) into the raw
+// (pre-compression) contents of a data block: a run of entries, each
+// prefix-compressed against the previous key, followed by a restart-point
+// array so a reader can binary search within the block instead of scanning
+// every entry.
+//
+// Every IndexInterval-th entry is a restart point and stores its key in
+// full (shared=0); the entries in between only store the suffix that
+// differs from the previous key.
+func encodeBlock(entries []Entry) []byte {
+	var buf bytes.Buffer
+	var varintBuf [binary.MaxVarintLen64]byte
+	var restarts []uint32
+	var prevKey string
+
+	for i, e := range entries {
+		var shared int
+		if i%IndexInterval == 0 {
+			restarts = append(restarts, uint32(buf.Len()))
+		} else {
+			shared = commonPrefixLen(prevKey, e.Key)
+		}
+		nonShared := e.Key[shared:]
+
+		n := binary.PutUvarint(varintBuf[:], uint64(shared))
+		buf.Write(varintBuf[:n])
+		n = binary.PutUvarint(varintBuf[:], uint64(len(nonShared)))
+		buf.Write(varintBuf[:n])
+		n = binary.PutUvarint(varintBuf[:], uint64(len(e.Value)))
+		buf.Write(varintBuf[:n])
+		n = binary.PutUvarint(varintBuf[:], e.Seq)
+		buf.Write(varintBuf[:n])
+		if e.Deleted {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		buf.WriteString(nonShared)
+		buf.WriteString(e.Value)
+
+		prevKey = e.Key
+	}
+
+	for _, r := range restarts {
+		binary.Write(&buf, binary.LittleEndian, r)
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(len(restarts)))
+
+	return buf.Bytes()
+}
+
+// splitBlockRestarts separates raw (as written by encodeBlock) into the
+// entry data and the restart offsets trailing it - each an index into
+// data at which a restart-point entry (shared=0) begins.
+func splitBlockRestarts(raw []byte) (restarts []uint32, data []byte, err error) {
+	if len(raw) < 4 {
+		return nil, nil, fmt.Errorf("block too small to contain a restart count")
+	}
+
+	numRestarts := binary.LittleEndian.Uint32(raw[len(raw)-4:])
+	restartsSize := int(numRestarts)*4 + 4
+	if restartsSize > len(raw) {
+		return nil, nil, fmt.Errorf("invalid restart section: %d restarts in a %d-byte block", numRestarts, len(raw))
+	}
+	data = raw[:len(raw)-restartsSize]
+
+	restartBytes := raw[len(raw)-restartsSize : len(raw)-4]
+	restarts = make([]uint32, numRestarts)
+	for i := range restarts {
+		restarts[i] = binary.LittleEndian.Uint32(restartBytes[i*4:])
+	}
+	return restarts, data, nil
+}
+
+// decodeEntry decodes the single entry at the start of data, given the key
+// of the entry decoded immediately before it in the same block (prevKey is
+// ignored at a restart point, where shared is always 0). It returns the
+// decoded entry and whatever of data follows it.
+func decodeEntry(data []byte, prevKey string) (entry Entry, rest []byte, err error) {
+	shared, n := binary.Uvarint(data)
+	if n <= 0 {
+		return Entry{}, nil, fmt.Errorf("invalid shared-prefix varint")
+	}
+	data = data[n:]
+
+	nonSharedLen, n := binary.Uvarint(data)
+	if n <= 0 {
+		return Entry{}, nil, fmt.Errorf("invalid non-shared-length varint")
+	}
+	data = data[n:]
+
+	valueLen, n := binary.Uvarint(data)
+	if n <= 0 {
+		return Entry{}, nil, fmt.Errorf("invalid value-length varint")
+	}
+	data = data[n:]
+
+	seq, n := binary.Uvarint(data)
+	if n <= 0 {
+		return Entry{}, nil, fmt.Errorf("invalid seq varint")
+	}
+	data = data[n:]
+
+	if len(data) < 1 {
+		return Entry{}, nil, fmt.Errorf("missing tombstone flag byte")
+	}
+	deleted := data[0] == 1
+	data = data[1:]
+
+	if uint64(shared) > uint64(len(prevKey)) || nonSharedLen > uint64(len(data)) {
+		return Entry{}, nil, fmt.Errorf("corrupt entry: shared=%d nonShared=%d prevKeyLen=%d remaining=%d", shared, nonSharedLen, len(prevKey), len(data))
+	}
+	nonShared := string(data[:nonSharedLen])
+	data = data[nonSharedLen:]
+
+	if valueLen > uint64(len(data)) {
+		return Entry{}, nil, fmt.Errorf("corrupt entry: value length %d exceeds remaining %d bytes", valueLen, len(data))
+	}
+	value := string(data[:valueLen])
+	data = data[valueLen:]
+
+	key := prevKey[:shared] + nonShared
+	return Entry{Key: key, Value: value, Deleted: deleted, Seq: seq}, data, nil
+}
+
+// decodeEntries decodes every entry in data, in order. data must start at a
+// restart point (shared=0), which holds for the pre-restart-array region
+// encodeBlock produces and for the sub-slice of it starting at any restart
+// offset.
+func decodeEntries(data []byte) ([]Entry, error) {
+	var entries []Entry
+	var prevKey string
+	for len(data) > 0 {
+		entry, rest, err := decodeEntry(data, prevKey)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		prevKey = entry.Key
+		data = rest
+	}
+	return entries, nil
+}
+
+// decodeBlock is the inverse of encodeBlock: it walks every entry in the
+// block in order. Use this when every entry is actually needed, e.g.
+// GetAllEntries or an Iterator materializing a block to walk forward and
+// backward through it; a single-key lookup should use lookupBlock instead,
+// which uses the restart array to skip straight to the right sub-range.
+func decodeBlock(raw []byte) ([]Entry, error) {
+	_, data, err := splitBlockRestarts(raw)
+	if err != nil {
+		return nil, err
+	}
+	return decodeEntries(data)
+}
+
+// lookupBlock returns the newest version of key with a sequence number no
+// greater than maxSeq, if the block contains one. It binary searches the
+// restart array for the last restart point whose key is < key (versions of
+// key are stored newest first and may begin before a restart point that
+// carries key itself), then decodes only from there to the end of the
+// block, instead of decoding
+// every entry from the start the way decodeBlock does - the restart array
+// exists precisely so a point lookup doesn't pay for every entry ahead of
+// the one it wants.
+func lookupBlock(raw []byte, key string, maxSeq uint64) (Entry, bool, error) {
+	restarts, data, err := splitBlockRestarts(raw)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	if len(restarts) == 0 {
+		return Entry{}, false, nil
+	}
+
+	var searchErr error
+	i := sort.Search(len(restarts), func(i int) bool {
+		entry, _, err := decodeEntry(data[restarts[i]:], "")
+		if err != nil {
+			searchErr = err
+			return true // stop the search; searchErr is checked below.
+		}
+		return entry.Key >= key
+	})
+	if searchErr != nil {
+		return Entry{}, false, searchErr
+	}
+	start := 0
+	if i > 0 {
+		start = i - 1
+	}
+
+	entries, err := decodeEntries(data[restarts[start]:])
+	if err != nil {
+		return Entry{}, false, err
+	}
+	for _, entry := range entries {
+		if entry.Key == key {
+			if entry.Seq <= maxSeq {
+				return entry, true, nil
+			}
+			continue
+		}
+		if entry.Key > key {
+			break
+		}
+	}
+	return Entry{}, false, nil
+}
+
+func commonPrefixLen(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+	return i
+}
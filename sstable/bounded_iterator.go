@@ -0,0 +1,73 @@
+package sstable
+
+// boundedIterator restricts an Iterator to the half-open range
+// [lower, upper); a nil bound leaves that side unrestricted. It unlocks
+// range queries like "key BETWEEN a AND b" without ever materializing keys
+// outside the range.
+type boundedIterator struct {
+	inner        Iterator
+	lower, upper []byte
+	outOfRange   bool
+}
+
+// newBoundedIterator wraps inner, seeking it to lower (or the very start,
+// if lower is nil) and positioning it on the first in-range entry.
+func newBoundedIterator(inner Iterator, lower, upper []byte) *boundedIterator {
+	b := &boundedIterator{inner: inner, lower: lower, upper: upper}
+	if lower != nil {
+		inner.Seek(string(lower))
+	} else {
+		inner.Seek("")
+	}
+	b.checkBounds()
+	return b
+}
+
+func (b *boundedIterator) checkBounds() {
+	if !b.inner.Valid() {
+		b.outOfRange = true
+		return
+	}
+	key := b.inner.Key()
+	if b.upper != nil && key >= string(b.upper) {
+		b.outOfRange = true
+		return
+	}
+	if b.lower != nil && key < string(b.lower) {
+		b.outOfRange = true
+		return
+	}
+	b.outOfRange = false
+}
+
+func (b *boundedIterator) Seek(key string) {
+	if b.lower != nil && key < string(b.lower) {
+		key = string(b.lower)
+	}
+	b.inner.Seek(key)
+	b.checkBounds()
+}
+
+func (b *boundedIterator) Next() bool {
+	if b.outOfRange || !b.inner.Next() {
+		b.outOfRange = true
+		return false
+	}
+	b.checkBounds()
+	return !b.outOfRange
+}
+
+func (b *boundedIterator) Prev() bool {
+	if b.outOfRange || !b.inner.Prev() {
+		b.outOfRange = true
+		return false
+	}
+	b.checkBounds()
+	return !b.outOfRange
+}
+
+func (b *boundedIterator) Valid() bool   { return !b.outOfRange && b.inner.Valid() }
+func (b *boundedIterator) Key() string   { return b.inner.Key() }
+func (b *boundedIterator) Value() string { return b.inner.Value() }
+func (b *boundedIterator) Close() error  { return b.inner.Close() }
+func (b *boundedIterator) Error() error  { return b.inner.Error() }
@@ -0,0 +1,205 @@
+package sstable
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dukky/toydb/storage"
+)
+
+// Iterator walks a sorted sequence of key/value pairs: a single SSTable,
+// the memtable, or a MergingIterator combining several sources into one
+// ordered view. An Iterator is not positioned until Seek, Next, or Prev is
+// called; Valid reports whether it currently sits on an entry.
+type Iterator interface {
+	Seek(key string)
+	Next() bool
+	Prev() bool
+	Valid() bool
+	Key() string
+	Value() string
+	Close() error
+	Error() error
+}
+
+// tombstoneAware is implemented by Iterators whose current entry might be a
+// delete marker. MergingIterator uses it to suppress shadowed keys instead
+// of surfacing tombstones as ordinary empty-value entries.
+type tombstoneAware interface {
+	Deleted() bool
+}
+
+func deletedAt(it Iterator) bool {
+	if ta, ok := it.(tombstoneAware); ok {
+		return ta.Deleted()
+	}
+	return false
+}
+
+// sliceIterator iterates over an already key-sorted, in-memory slice of
+// entries. It backs iteration over the memtable and over legacy (version 1)
+// SSTables, which load their entries as a whole rather than block by block.
+type sliceIterator struct {
+	entries []Entry
+	pos     int // -1 before the first entry, len(entries) after the last
+}
+
+func newSliceIterator(entries []Entry) *sliceIterator {
+	return &sliceIterator{entries: entries, pos: -1}
+}
+
+func (it *sliceIterator) Seek(key string) {
+	it.pos = sort.Search(len(it.entries), func(i int) bool {
+		return it.entries[i].Key >= key
+	})
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.pos < len(it.entries) {
+		it.pos++
+	}
+	return it.Valid()
+}
+
+func (it *sliceIterator) Prev() bool {
+	if it.pos >= 0 {
+		it.pos--
+	}
+	return it.Valid()
+}
+
+func (it *sliceIterator) Valid() bool {
+	return it.pos >= 0 && it.pos < len(it.entries)
+}
+
+func (it *sliceIterator) Key() string   { return it.entries[it.pos].Key }
+func (it *sliceIterator) Value() string { return it.entries[it.pos].Value }
+func (it *sliceIterator) Deleted() bool { return it.entries[it.pos].Deleted }
+func (it *sliceIterator) Seq() uint64   { return it.entries[it.pos].Seq }
+func (it *sliceIterator) Close() error  { return nil }
+func (it *sliceIterator) Error() error  { return nil }
+
+// sstableIterator walks a version 2 SSTable using its sparse index to load
+// one data block at a time, rather than reading the whole file up front.
+type sstableIterator struct {
+	sst      *SSTable
+	file     storage.Reader
+	blockIdx int     // index into sst.index for the loaded block
+	entries  []Entry // decoded entries of the loaded block
+	pos      int     // position within entries
+	err      error
+}
+
+// NewIterator returns an Iterator over every entry in sst, in key order.
+// Version 1 tables are read into memory up front; version 2 tables are
+// walked one data block at a time via the sparse index.
+func (sst *SSTable) NewIterator() (Iterator, error) {
+	if sst.footer.Version == 1 {
+		entries, err := sst.getAllEntriesLegacy()
+		if err != nil {
+			return nil, err
+		}
+		return newSliceIterator(entries), nil
+	}
+
+	file, err := sst.storage.Open(sst.fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSTable: %w", err)
+	}
+	sst.addRef()
+	return &sstableIterator{sst: sst, file: file, blockIdx: -1, pos: -1}, nil
+}
+
+// loadBlock decodes the data block at index idx of sst.index, or clears the
+// current block if idx is out of range (signalling there's nothing there).
+func (it *sstableIterator) loadBlock(idx int) bool {
+	if idx < 0 || idx >= len(it.sst.index) {
+		it.blockIdx = idx
+		it.entries = nil
+		return false
+	}
+	if idx == it.blockIdx && it.entries != nil {
+		return true
+	}
+
+	raw, err := readBlock(it.file, it.sst.fd, it.sst.index[idx].Handle)
+	if err != nil {
+		it.err = err
+		it.entries = nil
+		return false
+	}
+	entries, err := decodeBlock(raw)
+	if err != nil {
+		it.err = &ErrCorrupted{FileDesc: it.sst.fd, Reason: err.Error()}
+		it.entries = nil
+		return false
+	}
+
+	it.blockIdx = idx
+	it.entries = entries
+	return true
+}
+
+func (it *sstableIterator) Seek(key string) {
+	if it.err != nil {
+		return
+	}
+
+	idx := sort.Search(len(it.sst.index), func(i int) bool {
+		return it.sst.index[i].Key >= key
+	})
+	if !it.loadBlock(idx) {
+		it.pos = 0
+		return
+	}
+
+	it.pos = sort.Search(len(it.entries), func(i int) bool {
+		return it.entries[i].Key >= key
+	})
+}
+
+func (it *sstableIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.pos++
+	if it.pos < len(it.entries) {
+		return true
+	}
+	if !it.loadBlock(it.blockIdx + 1) {
+		return false
+	}
+	it.pos = 0
+	return len(it.entries) > 0
+}
+
+func (it *sstableIterator) Prev() bool {
+	if it.err != nil {
+		return false
+	}
+
+	it.pos--
+	if it.pos >= 0 {
+		return true
+	}
+	if !it.loadBlock(it.blockIdx - 1) {
+		return false
+	}
+	it.pos = len(it.entries) - 1
+	return it.pos >= 0
+}
+
+func (it *sstableIterator) Valid() bool {
+	return it.err == nil && it.pos >= 0 && it.pos < len(it.entries)
+}
+
+func (it *sstableIterator) Key() string   { return it.entries[it.pos].Key }
+func (it *sstableIterator) Value() string { return it.entries[it.pos].Value }
+func (it *sstableIterator) Deleted() bool { return it.entries[it.pos].Deleted }
+func (it *sstableIterator) Seq() uint64   { return it.entries[it.pos].Seq }
+func (it *sstableIterator) Close() error {
+	it.sst.release()
+	return it.file.Close()
+}
+func (it *sstableIterator) Error() error { return it.err }
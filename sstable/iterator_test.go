@@ -0,0 +1,206 @@
+package sstable
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/dukky/toydb/storage"
+)
+
+func TestSliceIteratorForwardAndBackward(t *testing.T) {
+	entries := []Entry{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "2"},
+		{Key: "c", Value: "3"},
+	}
+	it := newSliceIterator(entries)
+
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Key())
+	}
+	if fmt.Sprint(keys) != "[a b c]" {
+		t.Fatalf("forward scan = %v, want [a b c]", keys)
+	}
+
+	keys = nil
+	for it.Prev() {
+		keys = append(keys, it.Key())
+	}
+	if fmt.Sprint(keys) != "[c b a]" {
+		t.Fatalf("backward scan = %v, want [c b a]", keys)
+	}
+}
+
+func TestSliceIteratorSeek(t *testing.T) {
+	entries := []Entry{
+		{Key: "a", Value: "1"},
+		{Key: "c", Value: "3"},
+		{Key: "e", Value: "5"},
+	}
+	it := newSliceIterator(entries)
+
+	it.Seek("b")
+	if !it.Valid() || it.Key() != "c" {
+		t.Fatalf("Seek(b) landed on %q, want c", it.Key())
+	}
+
+	it.Seek("z")
+	if it.Valid() {
+		t.Fatalf("Seek(z) should be out of range, got key %q", it.Key())
+	}
+}
+
+func TestSSTableIteratorAcrossBlocks(t *testing.T) {
+	s := storage.NewMemStorage()
+	fd := storage.FileDesc{Type: storage.TypeSSTable, Num: 1}
+
+	var entries []Entry
+	for i := 0; i < 300; i++ {
+		entries = append(entries, Entry{Key: fmt.Sprintf("key%04d", i), Value: fmt.Sprintf("value%d", i)})
+	}
+	if err := WriteSSTable(s, fd, entries); err != nil {
+		t.Fatalf("WriteSSTable failed: %v", err)
+	}
+
+	sst, err := OpenSSTable(s, fd)
+	if err != nil {
+		t.Fatalf("OpenSSTable failed: %v", err)
+	}
+	if len(sst.index) < 2 {
+		t.Fatalf("expected test data to span multiple blocks, got %d", len(sst.index))
+	}
+
+	it, err := sst.NewIterator()
+	if err != nil {
+		t.Fatalf("NewIterator failed: %v", err)
+	}
+	defer it.Close()
+
+	it.Seek("key0150")
+	count := 0
+	for ; it.Valid(); it.Next() {
+		if it.Key() != fmt.Sprintf("key%04d", 150+count) {
+			t.Fatalf("entry %d = %q, want key%04d", count, it.Key(), 150+count)
+		}
+		count++
+	}
+	if count != 150 {
+		t.Fatalf("scanned %d entries from key0150, want 150", count)
+	}
+}
+
+func TestMergingIteratorNewestWins(t *testing.T) {
+	newest := newSliceIterator([]Entry{{Key: "b", Value: "new"}})
+	oldest := newSliceIterator([]Entry{
+		{Key: "a", Value: "old-a"},
+		{Key: "b", Value: "old-b"},
+		{Key: "c", Value: "old-c"},
+	})
+
+	merged := NewMergingIterator([]Iterator{newest, oldest}, math.MaxUint64)
+
+	var got []string
+	for merged.Next() {
+		got = append(got, merged.Key()+"="+merged.Value())
+	}
+
+	want := "[a=old-a b=new c=old-c]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("merged = %v, want %s", got, want)
+	}
+}
+
+func TestMergingIteratorTombstoneSuppression(t *testing.T) {
+	newest := newSliceIterator([]Entry{{Key: "b", Deleted: true}})
+	oldest := newSliceIterator([]Entry{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "old-b"},
+		{Key: "c", Value: "1"},
+	})
+
+	merged := NewMergingIterator([]Iterator{newest, oldest}, math.MaxUint64)
+
+	var got []string
+	for merged.Next() {
+		got = append(got, merged.Key())
+	}
+
+	want := "[a c]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("merged keys = %v, want %s (tombstoned key b must be suppressed)", got, want)
+	}
+}
+
+func TestSSTableDBNewIteratorRange(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("NewSSTableDB failed: %v", err)
+	}
+	defer db.Close()
+
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		if err := db.Write(k, "v-"+k); err != nil {
+			t.Fatalf("Write(%q) failed: %v", k, err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if err := db.Write("f", "v-f"); err != nil {
+		t.Fatalf("Write(f) failed: %v", err)
+	}
+
+	it, err := db.NewIterator([]byte("b"), []byte("e"))
+	if err != nil {
+		t.Fatalf("NewIterator failed: %v", err)
+	}
+	defer it.Close()
+
+	var keys []string
+	for ; it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+
+	want := "[b c d]"
+	if fmt.Sprint(keys) != want {
+		t.Fatalf("ranged iterator keys = %v, want %s", keys, want)
+	}
+}
+
+func TestSSTableDBScan(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("NewSSTableDB failed: %v", err)
+	}
+	defer db.Close()
+
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		if err := db.Write(k, "v-"+k); err != nil {
+			t.Fatalf("Write(%q) failed: %v", k, err)
+		}
+	}
+
+	entries, err := db.Scan("b", "e")
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Key+"="+e.Value)
+	}
+	want := "[b=v-b c=v-c d=v-d]"
+	if fmt.Sprint(got) != want {
+		t.Fatalf("Scan(b, e) = %v, want %s", got, want)
+	}
+
+	all, err := db.Scan("", "")
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if len(all) != 5 {
+		t.Fatalf("Scan(\"\", \"\") returned %d entries, want 5", len(all))
+	}
+}
@@ -0,0 +1,287 @@
+package sstable
+
+import (
+	"testing"
+
+	"github.com/dukky/toydb/storage"
+)
+
+func TestSSTableDBL0CompactsIntoL1(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	// Flush enough times to cross L0CompactionTrigger and push everything
+	// down into L1.
+	for i := 0; i < L0CompactionTrigger; i++ {
+		if err := db.Write("key1", "value1"); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+	}
+
+	if len(db.levels[0]) != 0 {
+		t.Errorf("Expected L0 to be empty after compaction, got %d files", len(db.levels[0]))
+	}
+	if len(db.levels[1]) == 0 {
+		t.Errorf("Expected L1 to hold the compacted data")
+	}
+
+	val, err := db.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read after compaction: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+}
+
+func TestSSTableDBCompactRange(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	for _, k := range []string{"a", "m", "z"} {
+		if err := db.Write(k, k+"-val"); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+	}
+
+	if err := db.CompactRange([]byte("a"), []byte("n")); err != nil {
+		t.Fatalf("Failed to compact range: %v", err)
+	}
+
+	if len(db.levels[1]) == 0 {
+		t.Errorf("Expected the compacted range to land in L1")
+	}
+
+	// "z" fell outside the requested range and stayed in L0.
+	found := false
+	for _, sst := range db.levels[0] {
+		if minKey, _, _ := sst.KeyRange(); minKey == "z" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected key z to remain in L0, untouched by CompactRange")
+	}
+
+	for _, k := range []string{"a", "m", "z"} {
+		val, err := db.Read(k)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", k, err)
+		}
+		if val != k+"-val" {
+			t.Errorf("For key %s, expected %s-val, got %s", k, k, val)
+		}
+	}
+}
+
+func TestSSTableDBStatsPerLevel(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	stats := db.Stats()
+	levels, ok := stats["levels"].([]map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected levels in Stats")
+	}
+	if len(levels) != maxLevels {
+		t.Errorf("Expected %d levels, got %d", maxLevels, len(levels))
+	}
+	if levels[0]["files"].(int) != 1 {
+		t.Errorf("Expected 1 file in L0, got %v", levels[0]["files"])
+	}
+}
+
+func TestSSTableDBManifestRecoversAcrossRestart(t *testing.T) {
+	s := storage.NewMemStorage()
+
+	db, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+
+	for i := 0; i < L0CompactionTrigger; i++ {
+		if err := db.Write("key1", "value1"); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+	}
+	db.Close()
+
+	db2, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to reopen SSTableDB: %v", err)
+	}
+	defer db2.Close()
+
+	if len(db2.levels[0]) != 0 || len(db2.levels[1]) == 0 {
+		t.Errorf("Expected the reopened database to still have its data in L1, levels: %v", db2.Stats()["levels"])
+	}
+
+	val, err := db2.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read after reopen: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+}
+
+func TestSSTableDBAsyncCompactionRunsInBackground(t *testing.T) {
+	db, err := NewSSTableDBWithOptions(storage.NewMemStorage(), Options{AsyncCompaction: true})
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+
+	for i := 0; i < L0CompactionTrigger; i++ {
+		if err := db.Write("key1", "value1"); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+	}
+
+	// Close waits for the background compaction goroutine to finish, so
+	// its effects are guaranteed visible once it returns.
+	if err := db.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	if err := db.CompactionError(); err != nil {
+		t.Fatalf("Background compaction failed: %v", err)
+	}
+	if len(db.levels[0]) != 0 {
+		t.Errorf("Expected L0 to be empty after background compaction, got %d files", len(db.levels[0]))
+	}
+	if len(db.levels[1]) == 0 {
+		t.Errorf("Expected L1 to hold the compacted data")
+	}
+}
+
+func TestIteratorPinsCompactedAwaySSTable(t *testing.T) {
+	s, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create FileStorage: %v", err)
+	}
+
+	db, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 500; i++ {
+		if err := db.Write(keyAt(i), "value"); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	fd := db.levels[0][0].FileDesc()
+
+	it, err := db.NewIterator(nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create iterator: %v", err)
+	}
+
+	// Compaction would normally remove fd's file immediately; it must
+	// defer that while it's still pinned by the open iterator above.
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if r, err := s.Open(fd); err != nil {
+		t.Fatalf("Expected pinned SSTable file to still exist during compaction, got: %v", err)
+	} else {
+		r.Close()
+	}
+
+	count := 0
+	for ; it.Valid(); it.Next() {
+		count++
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("Iterator error after reading through a compacted-away SSTable: %v", err)
+	}
+	if count != 500 {
+		t.Errorf("Expected 500 entries, got %d", count)
+	}
+
+	if err := it.Close(); err != nil {
+		t.Fatalf("Failed to close iterator: %v", err)
+	}
+
+	if _, err := s.Open(fd); err == nil {
+		t.Error("Expected the compacted-away SSTable file to be removed once the iterator closed")
+	}
+}
+
+func keyAt(i int) string {
+	return string(rune('a'+i%26)) + string(rune('A'+(i/26)%26)) + string(rune('0'+(i/(26*26))%10))
+}
+
+func TestSSTableDBOrphanFilesCleanedUpOnOpen(t *testing.T) {
+	s := storage.NewMemStorage()
+
+	db, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	db.Close()
+
+	// Simulate a compaction that wrote an output file but crashed before
+	// recording it in the MANIFEST.
+	orphanFd := storage.FileDesc{Type: storage.TypeSSTable, Num: 999999}
+	if err := WriteSSTable(s, orphanFd, []Entry{{Key: "orphan", Value: "v", Seq: 1}}); err != nil {
+		t.Fatalf("Failed to write orphan SSTable: %v", err)
+	}
+
+	db2, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to reopen SSTableDB: %v", err)
+	}
+	defer db2.Close()
+
+	if _, err := s.Open(orphanFd); err == nil {
+		t.Errorf("Expected orphaned SSTable to be removed on open")
+	}
+
+	val, err := db2.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read after reopen: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+}
@@ -0,0 +1,136 @@
+package sstable
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/dukky/toydb/storage"
+)
+
+// manifestFileDesc is the FileDesc of the MANIFEST edit log itself. There
+// is only ever one, so it always uses Num 0; storage.SetMeta/GetMeta is
+// how a database finds it again on reopen without scanning.
+var manifestFileDesc = storage.FileDesc{Type: storage.TypeManifest, Num: 0}
+
+// manifestFile names one SSTable (by its FileDesc.Num; the Type is always
+// storage.TypeSSTable) and the level it was added to.
+type manifestFile struct {
+	Level int `json:"level"`
+	Num   int `json:"num"`
+}
+
+// manifestEdit is one entry in the MANIFEST edit log: the files a flush or
+// compaction added and removed, plus the file ID counter as of this edit.
+// Replaying every edit in order reconstructs the current level assignment
+// of every live SSTable.
+type manifestEdit struct {
+	AddedFiles   []manifestFile `json:"added_files,omitempty"`
+	RemovedFiles []int          `json:"removed_files,omitempty"`
+	NextFileID   int            `json:"next_file_id"`
+}
+
+// manifest is an append-only, newline-delimited JSON edit log kept through
+// a storage.Storage. Each edit is appended via storage.Storage.Append
+// rather than a fsync'd rename - good enough for a toy store, not for a
+// production WAL.
+type manifest struct {
+	storage storage.Storage
+}
+
+func newManifest(s storage.Storage) (*manifest, error) {
+	if err := s.SetMeta(manifestFileDesc); err != nil {
+		return nil, fmt.Errorf("failed to record MANIFEST pointer: %w", err)
+	}
+	return &manifest{storage: s}, nil
+}
+
+// append records edit as the next entry in the log.
+func (m *manifest) append(edit manifestEdit) error {
+	data, err := json.Marshal(edit)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest edit: %w", err)
+	}
+	data = append(data, '\n')
+
+	file, err := m.storage.Append(manifestFileDesc)
+	if err != nil {
+		return fmt.Errorf("failed to open MANIFEST: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to append to MANIFEST: %w", err)
+	}
+	return nil
+}
+
+// replay reads every well-formed edit in the log, in the order they were
+// appended, and returns the file Nums currently live in each level (in the
+// order they were added) and the next file ID to hand out. It stops at the
+// first line that doesn't parse as a complete edit rather than returning an
+// error: a crash can leave the last append half-written, and every edit
+// before it is still trustworthy, matching replayWAL's recovery behavior.
+// found is false if no MANIFEST exists yet, e.g. a brand new data directory
+// or one written before leveled compaction existed.
+func (m *manifest) replay() (levelFiles map[int][]int, nextFileID int, found bool, err error) {
+	reader, err := m.storage.Open(manifestFileDesc)
+	if err != nil {
+		return nil, 0, false, nil
+	}
+	defer reader.Close()
+
+	size, err := reader.Size()
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to stat MANIFEST: %w", err)
+	}
+
+	levelFiles = make(map[int][]int)
+
+	scanner := bufio.NewScanner(io.NewSectionReader(reader, 0, size))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var edit manifestEdit
+		if err := json.Unmarshal(line, &edit); err != nil {
+			// A crash mid-append can truncate the last line anywhere,
+			// including partway through a previous line if the write
+			// landed across two storage.Append calls; either way, this
+			// and everything after it in the file is suspect, so stop
+			// here and keep what replayed cleanly.
+			break
+		}
+
+		for _, num := range edit.RemovedFiles {
+			for level, nums := range levelFiles {
+				if idx := indexOf(nums, num); idx >= 0 {
+					levelFiles[level] = append(nums[:idx], nums[idx+1:]...)
+					break
+				}
+			}
+		}
+		for _, f := range edit.AddedFiles {
+			levelFiles[f.Level] = append(levelFiles[f.Level], f.Num)
+		}
+		nextFileID = edit.NextFileID
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, false, fmt.Errorf("failed to read MANIFEST: %w", err)
+	}
+
+	return levelFiles, nextFileID, true, nil
+}
+
+func indexOf(nums []int, num int) int {
+	for i, n := range nums {
+		if n == num {
+			return i
+		}
+	}
+	return -1
+}
@@ -1,7 +1,8 @@
 package sstable
 
 import (
-	"sort"
+	"math"
+	"math/rand"
 	"sync"
 )
 
@@ -10,71 +11,162 @@ type Entry struct {
 	Key     string
 	Value   string
 	Deleted bool
+	Seq     uint64 // assigns a total order to writes; 0 for pre-MVCC legacy data
 }
 
-// Memtable is an in-memory sorted data structure for storing key-value pairs
+const (
+	// skipListMaxHeight bounds how many levels a node can participate in.
+	skipListMaxHeight = 12
+	// skipListP is the probability each level beyond the first gets added
+	// to a new node, the standard choice that keeps expected search cost
+	// at O(log n) without wasting levels on a small memtable.
+	skipListP = 0.25
+)
+
+// skipListNode is one key's slot in the skip list. versions holds every
+// buffered version of the key, newest first, so GetAtSeq can find the
+// newest version visible at a sequence number and GetSortedEntries can
+// emit every version.
+type skipListNode struct {
+	key      string
+	versions []Entry
+	forward  []*skipListNode // forward[i] is this node's successor at level i
+}
+
+// Memtable is an in-memory sorted data structure for storing key-value
+// pairs, implemented as a probabilistic skip list keyed by string: point
+// operations are O(log n) and an in-order walk of the bottom level costs
+// O(n) with no sort, unlike the map this replaced. Every write is kept as
+// a new version rather than overwriting the last one, newest first, so a
+// Snapshot taken before a later write can still see the value it had at
+// the time.
 type Memtable struct {
-	mu      sync.RWMutex
-	entries map[string]Entry
-	size    int // Approximate size in bytes
+	mu     sync.RWMutex
+	head   *skipListNode // sentinel with no key; head.forward[i] is level i's first real node
+	height int           // number of levels currently in use, 1..skipListMaxHeight
+	size   int           // approximate size in bytes, across all versions
 }
 
 // NewMemtable creates a new empty memtable
 func NewMemtable() *Memtable {
 	return &Memtable{
-		entries: make(map[string]Entry),
-		size:    0,
+		head:   &skipListNode{forward: make([]*skipListNode, skipListMaxHeight)},
+		height: 1,
 	}
 }
 
-// Put adds or updates a key-value pair in the memtable
-func (m *Memtable) Put(key, value string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// randomHeight picks a new node's height by flipping a skipListP-weighted
+// coin for each level beyond the first, capped at skipListMaxHeight.
+func randomHeight() int {
+	h := 1
+	for h < skipListMaxHeight && rand.Float64() < skipListP {
+		h++
+	}
+	return h
+}
 
-	// Remove old entry size if exists
-	if old, exists := m.entries[key]; exists {
-		m.size -= len(old.Key) + len(old.Value)
+// findPath locates where key belongs: update[i] is the last node at level
+// i whose key is less than key (or head, if none precede it). If key is
+// already present, update[0].forward[0] is its node. Caller must hold
+// m.mu.
+func (m *Memtable) findPath(key string) [skipListMaxHeight]*skipListNode {
+	var update [skipListMaxHeight]*skipListNode
+	node := m.head
+	for level := m.height - 1; level >= 0; level-- {
+		for node.forward[level] != nil && node.forward[level].key < key {
+			node = node.forward[level]
+		}
+		update[level] = node
 	}
+	return update
+}
 
-	entry := Entry{
-		Key:     key,
-		Value:   value,
-		Deleted: false,
+// node returns key's node, or nil if key has never been written. Caller
+// must hold at least m.mu's read lock.
+func (m *Memtable) node(key string) *skipListNode {
+	node := m.head
+	for level := m.height - 1; level >= 0; level-- {
+		for node.forward[level] != nil && node.forward[level].key < key {
+			node = node.forward[level]
+		}
 	}
-	m.entries[key] = entry
-	m.size += len(key) + len(value)
+	node = node.forward[0]
+	if node != nil && node.key == key {
+		return node
+	}
+	return nil
 }
 
-// Get retrieves a value by key from the memtable
-func (m *Memtable) Get(key string) (string, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// insert prepends entry to key's version list, creating key's node (and
+// splicing it into however many levels it's promoted to) on its first
+// write. Caller must hold m.mu.
+func (m *Memtable) insert(key string, entry Entry) {
+	update := m.findPath(key)
 
-	entry, exists := m.entries[key]
-	if !exists || entry.Deleted {
-		return "", false
+	if existing := update[0].forward[0]; existing != nil && existing.key == key {
+		existing.versions = append([]Entry{entry}, existing.versions...)
+		return
 	}
-	return entry.Value, true
+
+	height := randomHeight()
+	if height > m.height {
+		for level := m.height; level < height; level++ {
+			update[level] = m.head
+		}
+		m.height = height
+	}
+
+	node := &skipListNode{key: key, versions: []Entry{entry}, forward: make([]*skipListNode, height)}
+	for level := 0; level < height; level++ {
+		node.forward[level] = update[level].forward[level]
+		update[level].forward[level] = node
+	}
+}
+
+// Put records a new version of key at seq.
+func (m *Memtable) Put(key, value string, seq uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.insert(key, Entry{Key: key, Value: value, Seq: seq})
+	m.size += len(key) + len(value)
 }
 
-// Delete marks a key as deleted (tombstone)
-func (m *Memtable) Delete(key string) {
+// Delete records a tombstone for key at seq.
+func (m *Memtable) Delete(key string, seq uint64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Remove old entry size if exists
-	if old, exists := m.entries[key]; exists {
-		m.size -= len(old.Key) + len(old.Value)
+	m.insert(key, Entry{Key: key, Deleted: true, Seq: seq})
+	m.size += len(key)
+}
+
+// Get retrieves the latest value for key, ignoring tombstones.
+func (m *Memtable) Get(key string) (string, bool) {
+	entry, found := m.GetAtSeq(key, math.MaxUint64)
+	if !found || entry.Deleted {
+		return "", false
 	}
+	return entry.Value, true
+}
 
-	entry := Entry{
-		Key:     key,
-		Value:   "",
-		Deleted: true,
+// GetAtSeq returns the newest version of key with a sequence number no
+// greater than maxSeq, or ok=false if the memtable holds no such version
+// (the caller should then fall through to older SSTables).
+func (m *Memtable) GetAtSeq(key string, maxSeq uint64) (Entry, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node := m.node(key)
+	if node == nil {
+		return Entry{}, false
 	}
-	m.entries[key] = entry
-	m.size += len(key)
+	for _, e := range node.versions {
+		if e.Seq <= maxSeq {
+			return e, true
+		}
+	}
+	return Entry{}, false
 }
 
 // Size returns the approximate size of the memtable in bytes
@@ -88,34 +180,58 @@ func (m *Memtable) Size() int {
 func (m *Memtable) IsEmpty() bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return len(m.entries) == 0
+	return m.head.forward[0] == nil
 }
 
-// GetSortedEntries returns all entries sorted by key
+// GetSortedEntries returns every version of every key, sorted by key and
+// then newest-version-first, so a flush can write the full history a
+// Snapshot might still need. It's an in-order walk of the skip list's
+// bottom level, so unlike the map this replaced it needs no sort.
 func (m *Memtable) GetSortedEntries() []Entry {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	// Get sorted keys
-	keys := make([]string, 0, len(m.entries))
-	for key := range m.entries {
-		keys = append(keys, key)
+	var entries []Entry
+	for node := m.head.forward[0]; node != nil; node = node.forward[0] {
+		entries = append(entries, node.versions...)
 	}
-	sort.Strings(keys)
+	return entries
+}
 
-	// Build sorted entries slice
-	entries := make([]Entry, 0, len(keys))
-	for _, key := range keys {
-		entries = append(entries, m.entries[key])
+// Iterator returns an Iterator over every version of every key in
+// [start, end) - pass "" for either bound to leave that side
+// unrestricted - by walking the skip list's bottom level directly between
+// the two keys, rather than materializing the whole memtable the way
+// GetSortedEntries does. This is the substrate SSTableDB's range-scan API
+// merges against the SSTables on disk.
+func (m *Memtable) Iterator(start, end string) Iterator {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node := m.head
+	if start != "" {
+		for level := m.height - 1; level >= 0; level-- {
+			for node.forward[level] != nil && node.forward[level].key < start {
+				node = node.forward[level]
+			}
+		}
 	}
+	node = node.forward[0]
 
-	return entries
+	var entries []Entry
+	for node != nil && (end == "" || node.key < end) {
+		entries = append(entries, node.versions...)
+		node = node.forward[0]
+	}
+
+	return newSliceIterator(entries)
 }
 
 // Clear removes all entries from the memtable
 func (m *Memtable) Clear() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.entries = make(map[string]Entry)
+	m.head = &skipListNode{forward: make([]*skipListNode, skipListMaxHeight)}
+	m.height = 1
 	m.size = 0
 }
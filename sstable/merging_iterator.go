@@ -0,0 +1,223 @@
+package sstable
+
+// seqAware is implemented by Iterators whose current entry carries a
+// sequence number. MergingIterator uses it to hide versions written after
+// its maxSeq and to pick the newest visible version when several sources
+// (or several versions within one source) collide on a key.
+type seqAware interface {
+	Seq() uint64
+}
+
+func seqAt(it Iterator) uint64 {
+	if sa, ok := it.(seqAware); ok {
+		return sa.Seq()
+	}
+	return 0
+}
+
+// MergingIterator k-way merges a set of sources into a single ordered view,
+// as if they were one table, resolving any key that collides across (or
+// within) sources to its newest version with a sequence number no greater
+// than maxSeq. A tombstone winning that resolution suppresses every older
+// version of the key rather than surfacing it.
+type MergingIterator struct {
+	sources []Iterator
+	maxSeq  uint64
+	started bool
+	valid   bool
+	key     string
+	value   string
+}
+
+// NewMergingIterator returns a MergingIterator over sources. maxSeq bounds
+// which versions are visible; pass math.MaxUint64 for an unbounded (latest
+// value wins) view.
+func NewMergingIterator(sources []Iterator, maxSeq uint64) *MergingIterator {
+	return &MergingIterator{sources: sources, maxSeq: maxSeq}
+}
+
+func (m *MergingIterator) Seek(key string) {
+	for _, s := range m.sources {
+		s.Seek(key)
+	}
+	m.started = true
+	m.settleForward()
+}
+
+func (m *MergingIterator) Next() bool {
+	if m.started && m.valid {
+		m.advancePast(m.key, forward)
+	} else if !m.started {
+		for _, s := range m.sources {
+			s.Next()
+		}
+	}
+	m.started = true
+	m.settleForward()
+	return m.valid
+}
+
+func (m *MergingIterator) Prev() bool {
+	if m.started && m.valid {
+		m.advancePast(m.key, backward)
+	} else if !m.started {
+		for _, s := range m.sources {
+			s.Prev()
+		}
+	}
+	m.started = true
+	m.settleBackward()
+	return m.valid
+}
+
+func (m *MergingIterator) Valid() bool   { return m.valid }
+func (m *MergingIterator) Key() string   { return m.key }
+func (m *MergingIterator) Value() string { return m.value }
+
+func (m *MergingIterator) Close() error {
+	var firstErr error
+	for _, s := range m.sources {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (m *MergingIterator) Error() error {
+	for _, s := range m.sources {
+		if err := s.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type direction int
+
+const (
+	forward direction = iota
+	backward
+)
+
+// advancePast moves every source currently positioned on key past every
+// version of it - visible or not - so a key that's just been emitted (or
+// shadowed) is never seen again.
+func (m *MergingIterator) advancePast(key string, dir direction) {
+	for _, s := range m.sources {
+		for s.Valid() && s.Key() == key {
+			if dir == forward {
+				s.Next()
+			} else {
+				s.Prev()
+			}
+		}
+	}
+}
+
+// skipInvisible moves every source past whatever run of versions it's
+// currently sitting on that are newer than maxSeq, landing it on the next
+// version (of the same or a different key) that the snapshot can see.
+func (m *MergingIterator) skipInvisible(dir direction) {
+	for _, s := range m.sources {
+		for s.Valid() && seqAt(s) > m.maxSeq {
+			if dir == forward {
+				s.Next()
+			} else {
+				s.Prev()
+			}
+		}
+	}
+}
+
+// settleForward finds the lexicographically smallest key among the
+// sources' current (visible) positions, resolves which version of it wins,
+// and either emits it or - if the winner is a tombstone - advances past
+// every version of that key and tries again.
+func (m *MergingIterator) settleForward() {
+	for {
+		m.skipInvisible(forward)
+		winner, key, ok := m.pickWinner(forward)
+		if !ok {
+			m.valid = false
+			return
+		}
+		isDeleted := deletedAt(winner)
+		value := winner.Value()
+		m.advancePast(key, forward)
+
+		if isDeleted {
+			continue
+		}
+
+		m.key, m.value, m.valid = key, value, true
+		return
+	}
+}
+
+// settleBackward is settleForward's mirror image for reverse iteration: it
+// picks the largest current key instead of the smallest. Walking backward,
+// a source reaches a key's oldest version first, so rather than trusting
+// the version each source sits on, it steps every source back through all
+// versions of the key and keeps the newest one visible at maxSeq.
+func (m *MergingIterator) settleBackward() {
+	for {
+		m.skipInvisible(backward)
+		_, key, ok := m.pickWinner(backward)
+		if !ok {
+			m.valid = false
+			return
+		}
+		var value string
+		var isDeleted, haveWinner bool
+		var winnerSeq uint64
+		for _, s := range m.sources {
+			for s.Valid() && s.Key() == key {
+				if seq := seqAt(s); seq <= m.maxSeq && (!haveWinner || seq > winnerSeq) {
+					value, isDeleted, winnerSeq, haveWinner = s.Value(), deletedAt(s), seq, true
+				}
+				s.Prev()
+			}
+		}
+
+		if isDeleted {
+			continue
+		}
+
+		m.key, m.value, m.valid = key, value, true
+		return
+	}
+}
+
+// pickWinner finds the extreme (smallest for forward, largest for
+// backward) key among the sources' current, visible positions, and returns
+// whichever of them sitting on it has the highest sequence number - the
+// newest version visible at maxSeq.
+func (m *MergingIterator) pickWinner(dir direction) (Iterator, string, bool) {
+	found := false
+	var extremeKey string
+	for _, s := range m.sources {
+		if !s.Valid() {
+			continue
+		}
+		if !found || (dir == forward && s.Key() < extremeKey) || (dir == backward && s.Key() > extremeKey) {
+			extremeKey = s.Key()
+			found = true
+		}
+	}
+	if !found {
+		return nil, "", false
+	}
+
+	var winner Iterator
+	var winnerSeq uint64
+	haveWinner := false
+	for _, s := range m.sources {
+		if s.Valid() && s.Key() == extremeKey {
+			if seq := seqAt(s); !haveWinner || seq > winnerSeq {
+				winner, winnerSeq, haveWinner = s, seq, true
+			}
+		}
+	}
+	return winner, extremeKey, true
+}
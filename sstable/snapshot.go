@@ -0,0 +1,80 @@
+package sstable
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Snapshot is a point-in-time, read-only view of an SSTableDB: it pins the
+// sequence number in effect when it was taken, so later writes (and the
+// versions of old keys they obsolete) stay invisible to it until Release.
+type Snapshot struct {
+	db  *SSTableDB
+	seq uint64
+}
+
+// GetSnapshot returns a Snapshot pinned to the database's current sequence
+// number. The snapshot must be released with Release once the caller is
+// done with it, so compaction can reclaim versions it no longer needs to
+// keep around.
+func (db *SSTableDB) GetSnapshot() *Snapshot {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	snap := &Snapshot{db: db, seq: db.seq}
+
+	idx := sort.Search(len(db.liveSnapshots), func(i int) bool {
+		return db.liveSnapshots[i] >= snap.seq
+	})
+	db.liveSnapshots = append(db.liveSnapshots, 0)
+	copy(db.liveSnapshots[idx+1:], db.liveSnapshots[idx:])
+	db.liveSnapshots[idx] = snap.seq
+
+	return snap
+}
+
+// Seq returns the sequence number this snapshot is pinned to - the seq of
+// the last write it can see.
+func (s *Snapshot) Seq() uint64 {
+	return s.seq
+}
+
+// Get reads the value of key as of the snapshot's sequence number.
+func (s *Snapshot) Get(key string) (string, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	entry, found, err := s.db.readAtSeq(key, s.seq)
+	if err != nil {
+		return "", err
+	}
+	if !found || entry.Deleted {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
+	return entry.Value, nil
+}
+
+// NewIterator returns an Iterator over the snapshot's view of the
+// database, restricted to the half-open range [lower, upper). Either
+// bound may be nil to leave that side unrestricted.
+func (s *Snapshot) NewIterator(lower, upper []byte) (Iterator, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	return s.db.newIteratorAtSeq(lower, upper, s.seq)
+}
+
+// Release lets the database know this snapshot is no longer in use, so
+// compaction can stop retaining versions that existed solely for it.
+func (s *Snapshot) Release() {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	live := s.db.liveSnapshots
+	for i, seq := range live {
+		if seq == s.seq {
+			s.db.liveSnapshots = append(live[:i], live[i+1:]...)
+			return
+		}
+	}
+}
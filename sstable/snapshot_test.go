@@ -0,0 +1,224 @@
+package sstable
+
+import (
+	"testing"
+
+	"github.com/dukky/toydb/storage"
+)
+
+func TestSnapshotIsolatesLaterWrites(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	snap := db.GetSnapshot()
+	defer snap.Release()
+
+	if err := db.Write("key1", "value2"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Write("key2", "value2"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	val, err := snap.Get("key1")
+	if err != nil {
+		t.Fatalf("Failed to read from snapshot: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected snapshot to see value1, got %s", val)
+	}
+
+	if _, err := snap.Get("key2"); err == nil {
+		t.Error("Expected error reading key written after the snapshot was taken")
+	}
+
+	// The live database sees the later writes.
+	val, err = db.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if val != "value2" {
+		t.Errorf("Expected db.Read to see value2, got %s", val)
+	}
+}
+
+func TestSnapshotSeesDeleteAfterIt(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	snap := db.GetSnapshot()
+	defer snap.Release()
+
+	if err := db.Delete("key1"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	val, err := snap.Get("key1")
+	if err != nil {
+		t.Fatalf("Expected snapshot to still see key1: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+
+	if _, err := db.Read("key1"); err == nil {
+		t.Error("Expected error reading deleted key from the live database")
+	}
+}
+
+func TestSnapshotSurvivesCompaction(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	snap := db.GetSnapshot()
+	defer snap.Release()
+
+	if err := db.Write("key1", "value2"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	val, err := snap.Get("key1")
+	if err != nil {
+		t.Fatalf("Failed to read from snapshot after compaction: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected snapshot to still see value1 after compaction, got %s", val)
+	}
+
+	val, err = db.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	if val != "value2" {
+		t.Errorf("Expected db.Read to see value2, got %s", val)
+	}
+}
+
+func TestSnapshotSurvivesCompactionAfterDelete(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	snap := db.GetSnapshot()
+
+	if err := db.Delete("key1"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	// Compacting while the snapshot is still live must not physically
+	// drop the tombstone: the snapshot predates the delete and still
+	// needs to see key1's old value.
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+
+	val, err := snap.Get("key1")
+	if err != nil {
+		t.Fatalf("Expected snapshot to still see key1 after compaction: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+
+	if _, err := db.Read("key1"); err == nil {
+		t.Error("Expected the live database to see key1 as deleted")
+	}
+
+	// Once the snapshot is released, a further compaction is free to
+	// drop the tombstone for good.
+	snap.Release()
+	if err := db.Compact(); err != nil {
+		t.Fatalf("Failed to compact after releasing snapshot: %v", err)
+	}
+	if _, err := db.Read("key1"); err == nil {
+		t.Error("Expected key1 to still read as deleted")
+	}
+}
+
+func TestSnapshotIterator(t *testing.T) {
+	db, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := db.Write(k, k+"-old"); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	snap := db.GetSnapshot()
+	defer snap.Release()
+
+	if err := db.Write("b", "b-new"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Write("d", "d-new"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	it, err := snap.NewIterator(nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create snapshot iterator: %v", err)
+	}
+	defer it.Close()
+
+	var got []string
+	for ; it.Valid(); it.Next() {
+		got = append(got, it.Key()+"="+it.Value())
+	}
+	want := []string{"a=a-old", "b=b-old", "c=c-old"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, got)
+			break
+		}
+	}
+}
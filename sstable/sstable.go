@@ -2,350 +2,570 @@ package sstable
 
 import (
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
-	"os"
+	"hash/crc32"
+	"math"
 	"sort"
+	"sync/atomic"
+
+	"github.com/dukky/toydb/filter"
+	"github.com/dukky/toydb/snappy"
+	"github.com/dukky/toydb/storage"
 )
 
 const (
-	// IndexInterval defines how often we create an index entry (every Nth key)
+	// IndexInterval defines how often a block stores a full (non-prefix-
+	// compressed) restart key. Data blocks are cut by size (targetBlockSize),
+	// not by entry count.
 	IndexInterval = 16
-	// SSTableVersion is the file format version
-	SSTableVersion = 1
+	// SSTableVersion is the file format version written by this build.
+	// Version 1 files (flat JSON-framed entries) are still readable; see
+	// sstable_legacy.go.
+	SSTableVersion = 2
+
+	// targetBlockSize is the approximate uncompressed size, in bytes, that
+	// WriteSSTable tries to fill before starting a new data block.
+	targetBlockSize = 4096
+
+	compressionNone   byte = 0
+	compressionSnappy byte = 1
+
+	// blockTrailerSize is the 1-byte compression type plus the 4-byte
+	// CRC32C checksum that follows every block's payload.
+	blockTrailerSize = 5
+
+	// footerSize is the fixed size of the v2 footer: version(1) +
+	// indexOffset(8) + indexLength(8) + filterOffset(8) + filterLength(8) +
+	// magic(4). A zero-length filter handle means the table was written
+	// with the bloom filter disabled.
+	footerSize = 37
+
+	magicNumber uint32 = 0x53535442 // "SSTB"
+
+	// filterBitsPerKey is the default bloom filter density; see the filter
+	// package for what this buys in false-positive rate.
+	filterBitsPerKey = filter.DefaultBitsPerKey
 )
 
-// IndexEntry represents an entry in the sparse index
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// BlockHandle locates a block within an SSTable file: its payload spans
+// [Offset, Offset+Length); the compression-type byte and CRC32C checksum
+// immediately follow.
+type BlockHandle struct {
+	Offset int64
+	Length int64
+}
+
+// IndexEntry maps the largest key in a data block to that block's handle.
 type IndexEntry struct {
 	Key    string
-	Offset int64
+	Handle BlockHandle
 }
 
-// SSTableFooter contains metadata about the SSTable
+// SSTableFooter contains metadata about the SSTable.
 type SSTableFooter struct {
-	Version     int
-	IndexOffset int64 // Byte offset where the index starts
-	NumEntries  int   // Total number of data entries
+	Version      int
+	IndexHandle  BlockHandle
+	FilterHandle BlockHandle // zero value means no bloom filter was written
+}
+
+// ErrCorrupted is returned when an SSTable file fails a checksum or
+// structural sanity check while being read.
+type ErrCorrupted struct {
+	FileDesc storage.FileDesc
+	Reason   string
+}
+
+func (e *ErrCorrupted) Error() string {
+	return fmt.Sprintf("sstable %s: corrupted: %s", e.FileDesc, e.Reason)
 }
 
-// SSTable represents a sorted string table on disk
+// SSTable represents a sorted string table, read through a storage.Storage.
 type SSTable struct {
-	FilePath string
-	index    []IndexEntry    // Sparse index loaded in memory
-	footer   SSTableFooter
+	storage storage.Storage
+	fd      storage.FileDesc
+	footer  SSTableFooter
+
+	// index is populated for version 2 files; legacyIndex for version 1.
+	index       []IndexEntry
+	legacyIndex []legacyIndexEntry
+
+	// filter is nil if the table has no bloom filter, either because it
+	// predates this feature or because it was written with one disabled.
+	filter *filter.BloomFilter
+
+	// filterRejections counts Get/GetAtSeq calls the bloom filter answered
+	// without touching disk. Updated with atomic.AddInt64; see
+	// FilterRejections.
+	filterRejections int64
+
+	// minKey, maxKey cache the result of KeyRange.
+	minKey, maxKey string
+	haveKeyRange   bool
+
+	// refs counts open iterators currently streaming blocks from this
+	// SSTable's file. pendingRemoval is set if a compaction has already
+	// superseded this table and wants its file removed, but had to defer
+	// that until refs drops to zero - see addRef/release and
+	// SSTableDB.removeSSTable.
+	refs           int32
+	pendingRemoval int32
 }
 
-// WriteSSTable writes a sorted list of entries to disk as an SSTable
-func WriteSSTable(filePath string, entries []Entry) error {
-	// Create temporary file for atomic write
-	tempPath := filePath + ".tmp"
-	file, err := os.Create(tempPath)
-	if err != nil {
-		return fmt.Errorf("failed to create SSTable file: %w", err)
+// addRef pins sst's file against removal until a matching release. Only
+// needed around disk access outside the protection of SSTableDB.mu, i.e.
+// the block-streaming iterator path in NewIterator.
+func (sst *SSTable) addRef() {
+	atomic.AddInt32(&sst.refs, 1)
+}
+
+// release undoes one addRef. If this was the last reference and a
+// compaction already asked for sst's file to be removed once it was safe,
+// release removes it now. Re-checking pendingRemoval after the decrement
+// (rather than only at the moment a compaction asks for removal) is what
+// makes this safe against the removal request landing just before the
+// last release: whichever of the two runs last sees both the dropped ref
+// and the pending flag set.
+func (sst *SSTable) release() {
+	if atomic.AddInt32(&sst.refs, -1) == 0 && atomic.LoadInt32(&sst.pendingRemoval) == 1 &&
+		atomic.CompareAndSwapInt32(&sst.pendingRemoval, 1, 0) {
+		sst.storage.Remove(sst.fd)
 	}
+}
 
-	// Ensure entries are sorted
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Key < entries[j].Key
-	})
+// FilterRejections returns the number of point lookups this SSTable's bloom
+// filter has answered "definitely not present" without reading a block.
+func (sst *SSTable) FilterRejections() int64 {
+	return atomic.LoadInt64(&sst.filterRejections)
+}
 
-	// Write data entries and build sparse index
-	var index []IndexEntry
-	var offset int64 = 0
+// FileDesc returns the storage.FileDesc this SSTable was opened from.
+func (sst *SSTable) FileDesc() storage.FileDesc {
+	return sst.fd
+}
 
-	for i, entry := range entries {
-		// Record index entry every IndexInterval entries
-		if i%IndexInterval == 0 {
-			index = append(index, IndexEntry{
-				Key:    entry.Key,
-				Offset: offset,
-			})
-		}
+// Size returns the SSTable's size on disk in bytes, or 0 if it can't be
+// determined.
+func (sst *SSTable) Size() int64 {
+	file, err := sst.storage.Open(sst.fd)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
 
-		// Serialize entry to JSON
-		data, err := json.Marshal(entry)
-		if err != nil {
-			return fmt.Errorf("failed to marshal entry: %w", err)
-		}
+	size, err := file.Size()
+	if err != nil {
+		return 0
+	}
+	return size
+}
 
-		// Write length prefix (8 bytes)
-		length := int64(len(data))
-		if err := binary.Write(file, binary.LittleEndian, length); err != nil {
-			return fmt.Errorf("failed to write entry length: %w", err)
-		}
-		offset += 8
+// WriteOptions controls how WriteSSTable builds a new SSTable file.
+type WriteOptions struct {
+	// DisableBloomFilter skips building and persisting a bloom filter
+	// block, trading a smaller file and faster writes for slower
+	// negative lookups.
+	DisableBloomFilter bool
+}
 
-		// Write data
-		n, err := file.Write(data)
-		if err != nil {
-			return fmt.Errorf("failed to write entry data: %w", err)
-		}
-		offset += int64(n)
-	}
+// WriteSSTable writes a sorted list of entries to fd as a version 2
+// SSTable, with a bloom filter built at the default bits-per-key. See
+// WriteSSTableWithOptions to disable the filter.
+func WriteSSTable(s storage.Storage, fd storage.FileDesc, entries []Entry) error {
+	return WriteSSTableWithOptions(s, fd, entries, WriteOptions{})
+}
 
-	// Record the start of the index section
-	indexOffset := offset
+// WriteSSTableWithOptions writes a sorted list of entries to fd as a
+// version 2 SSTable: data is split into ~4 KiB blocks, each prefix-
+// compressed, optionally Snappy-compressed, and checksummed with CRC32C.
+func WriteSSTableWithOptions(s storage.Storage, fd storage.FileDesc, entries []Entry, opts WriteOptions) error {
+	file, err := s.Create(fd)
+	if err != nil {
+		return fmt.Errorf("failed to create SSTable file: %w", err)
+	}
 
-	// Write sparse index
-	for _, idxEntry := range index {
-		data, err := json.Marshal(idxEntry)
-		if err != nil {
-			return fmt.Errorf("failed to marshal index entry: %w", err)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
 		}
+		return entries[i].Seq > entries[j].Seq
+	})
 
-		// Write length prefix
-		length := int64(len(data))
-		if err := binary.Write(file, binary.LittleEndian, length); err != nil {
-			return fmt.Errorf("failed to write index entry length: %w", err)
-		}
+	var index []IndexEntry
+	var offset int64
+	var pending []Entry
+	var pendingSize int
 
-		// Write data
-		if _, err := file.Write(data); err != nil {
-			return fmt.Errorf("failed to write index entry data: %w", err)
+	flushBlock := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		handle, err := writeBlock(file, offset, encodeBlock(pending))
+		if err != nil {
+			return fmt.Errorf("failed to write data block: %w", err)
 		}
+		index = append(index, IndexEntry{Key: pending[len(pending)-1].Key, Handle: handle})
+		offset += handle.Length + blockTrailerSize
+		pending = pending[:0]
+		pendingSize = 0
+		return nil
 	}
 
-	// Write footer
-	footer := SSTableFooter{
-		Version:     SSTableVersion,
-		IndexOffset: indexOffset,
-		NumEntries:  len(entries),
-	}
-	footerData, err := json.Marshal(footer)
-	if err != nil {
-		return fmt.Errorf("failed to marshal footer: %w", err)
+	for i, entry := range entries {
+		pending = append(pending, entry)
+		pendingSize += len(entry.Key) + len(entry.Value) + 3
+		// Never split versions of the same key across two data blocks: a
+		// single-block scan in GetAtSeq relies on every version of a key
+		// being found together.
+		atKeyBoundary := i == len(entries)-1 || entries[i+1].Key != entry.Key
+		if pendingSize >= targetBlockSize && atKeyBoundary {
+			if err := flushBlock(); err != nil {
+				file.Close()
+				return err
+			}
+		}
 	}
-
-	// Write footer data first
-	if _, err := file.Write(footerData); err != nil {
-		return fmt.Errorf("failed to write footer data: %w", err)
+	if err := flushBlock(); err != nil {
+		file.Close()
+		return err
 	}
 
-	// Write footer length last (so we can find it at the end of the file)
-	footerLength := int64(len(footerData))
-	if err := binary.Write(file, binary.LittleEndian, footerLength); err != nil {
-		return fmt.Errorf("failed to write footer length: %w", err)
+	indexHandle, err := writeBlock(file, offset, encodeIndexBlock(index))
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write index block: %w", err)
 	}
+	offset += indexHandle.Length + blockTrailerSize
 
-	// Sync to disk
-	if err := file.Sync(); err != nil {
-		return fmt.Errorf("failed to sync SSTable file: %w", err)
+	var filterHandle BlockHandle
+	if !opts.DisableBloomFilter {
+		keys := make([]string, len(entries))
+		for i, entry := range entries {
+			keys[i] = entry.Key
+		}
+		bf := filter.New(keys, filterBitsPerKey)
+		filterHandle, err = writeBlock(file, offset, bf.Encode())
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write filter block: %w", err)
+		}
 	}
 
-	// Close before rename
-	file.Close()
-
-	// Atomic rename
-	if err := os.Rename(tempPath, filePath); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to rename SSTable file: %w", err)
+	footer := make([]byte, footerSize)
+	footer[0] = byte(SSTableVersion)
+	binary.LittleEndian.PutUint64(footer[1:9], uint64(indexHandle.Offset))
+	binary.LittleEndian.PutUint64(footer[9:17], uint64(indexHandle.Length))
+	binary.LittleEndian.PutUint64(footer[17:25], uint64(filterHandle.Offset))
+	binary.LittleEndian.PutUint64(footer[25:33], uint64(filterHandle.Length))
+	binary.LittleEndian.PutUint32(footer[33:37], magicNumber)
+	if _, err := file.Write(footer); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write footer: %w", err)
 	}
 
-	return nil
+	return file.Close()
 }
 
-// OpenSSTable opens an existing SSTable and loads its index into memory
-func OpenSSTable(filePath string) (*SSTable, error) {
-	file, err := os.Open(filePath)
+// OpenSSTable opens the SSTable at fd and loads its index into memory. It
+// recognizes version 2 files by their fixed-size, magic-terminated footer
+// and falls back to the version 1 (flat JSON) reader otherwise.
+func OpenSSTable(s storage.Storage, fd storage.FileDesc) (*SSTable, error) {
+	file, err := s.Open(fd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open SSTable: %w", err)
 	}
 	defer file.Close()
 
-	// Get file size
-	stat, err := file.Stat()
+	fileSize, err := file.Size()
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat SSTable: %w", err)
 	}
-	fileSize := stat.Size()
 
-	if fileSize < 8 {
-		return nil, fmt.Errorf("SSTable file too small")
+	if fileSize >= footerSize {
+		footer := make([]byte, footerSize)
+		if _, err := file.ReadAt(footer, fileSize-footerSize); err == nil {
+			if binary.LittleEndian.Uint32(footer[33:37]) == magicNumber {
+				indexOffset := int64(binary.LittleEndian.Uint64(footer[1:9]))
+				indexLength := int64(binary.LittleEndian.Uint64(footer[9:17]))
+				filterOffset := int64(binary.LittleEndian.Uint64(footer[17:25]))
+				filterLength := int64(binary.LittleEndian.Uint64(footer[25:33]))
+
+				indexRaw, err := readBlock(file, fd, BlockHandle{Offset: indexOffset, Length: indexLength})
+				if err != nil {
+					return nil, err
+				}
+				index, err := decodeIndexBlock(indexRaw)
+				if err != nil {
+					return nil, &ErrCorrupted{FileDesc: fd, Reason: err.Error()}
+				}
+
+				var bf *filter.BloomFilter
+				if filterLength > 0 {
+					filterRaw, err := readBlock(file, fd, BlockHandle{Offset: filterOffset, Length: filterLength})
+					if err != nil {
+						return nil, err
+					}
+					bf, err = filter.Decode(filterRaw)
+					if err != nil {
+						return nil, &ErrCorrupted{FileDesc: fd, Reason: err.Error()}
+					}
+				}
+
+				return &SSTable{
+					storage: s,
+					fd:      fd,
+					index:   index,
+					filter:  bf,
+					footer: SSTableFooter{
+						Version:      int(footer[0]),
+						IndexHandle:  BlockHandle{Offset: indexOffset, Length: indexLength},
+						FilterHandle: BlockHandle{Offset: filterOffset, Length: filterLength},
+					},
+				}, nil
+			}
+		}
 	}
 
-	// Read footer length (last 8 bytes)
-	if _, err := file.Seek(fileSize-8, 0); err != nil {
-		return nil, fmt.Errorf("failed to seek to footer length: %w", err)
+	return openLegacySSTable(s, fd, file, fileSize)
+}
+
+// Get retrieves the newest value for key, ignoring any sequence numbers.
+// Returns (value, exists, error) where exists=true even for tombstones.
+// Check if value is empty and exists=true to detect tombstones.
+func (sst *SSTable) Get(key string) (string, bool, error) {
+	if sst.footer.Version == 1 {
+		return sst.getLegacy(key)
 	}
 
-	var footerLength int64
-	if err := binary.Read(file, binary.LittleEndian, &footerLength); err != nil {
-		return nil, fmt.Errorf("failed to read footer length: %w", err)
+	entry, found, err := sst.GetAtSeq(key, math.MaxUint64)
+	if err != nil || !found {
+		return "", false, err
+	}
+	if entry.Deleted {
+		return "", true, nil
 	}
+	return entry.Value, true, nil
+}
 
-	// Read footer
-	footerOffset := fileSize - 8 - footerLength
-	if footerOffset < 0 {
-		return nil, fmt.Errorf("invalid footer offset: %d (fileSize=%d, footerLength=%d)", footerOffset, fileSize, footerLength)
+// GetAtSeq retrieves the newest version of key with a sequence number no
+// greater than maxSeq. Returns (entry, exists, error) where exists=true
+// even for tombstones; check entry.Deleted to detect them.
+func (sst *SSTable) GetAtSeq(key string, maxSeq uint64) (Entry, bool, error) {
+	if sst.footer.Version == 1 {
+		value, found, err := sst.getLegacy(key)
+		if err != nil || !found {
+			return Entry{}, found, err
+		}
+		return Entry{Key: key, Value: value, Deleted: value == ""}, true, nil
 	}
-	if _, err := file.Seek(footerOffset, 0); err != nil {
-		return nil, fmt.Errorf("failed to seek to footer: %w", err)
+
+	if sst.filter != nil && !sst.filter.MayContain(key) {
+		atomic.AddInt64(&sst.filterRejections, 1)
+		return Entry{}, false, nil
 	}
 
-	footerData := make([]byte, footerLength)
-	if _, err := file.Read(footerData); err != nil {
-		return nil, fmt.Errorf("failed to read footer: %w", err)
+	file, err := sst.storage.Open(sst.fd)
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to open SSTable: %w", err)
 	}
+	defer file.Close()
 
-	var footer SSTableFooter
-	if err := json.Unmarshal(footerData, &footer); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal footer: %w", err)
+	idx := sort.Search(len(sst.index), func(i int) bool {
+		return sst.index[i].Key >= key
+	})
+	if idx == len(sst.index) {
+		// key is greater than every key stored in this table.
+		return Entry{}, false, nil
 	}
 
-	// Read sparse index
-	if _, err := file.Seek(footer.IndexOffset, 0); err != nil {
-		return nil, fmt.Errorf("failed to seek to index: %w", err)
+	raw, err := readBlock(file, sst.fd, sst.index[idx].Handle)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	entry, found, err := lookupBlock(raw, key, maxSeq)
+	if err != nil {
+		return Entry{}, false, &ErrCorrupted{FileDesc: sst.fd, Reason: err.Error()}
 	}
+	return entry, found, nil
+}
 
-	var index []IndexEntry
-	currentOffset := footer.IndexOffset
+// GetAllEntries returns all entries in the SSTable, in key order.
+func (sst *SSTable) GetAllEntries() ([]Entry, error) {
+	if sst.footer.Version == 1 {
+		return sst.getAllEntriesLegacy()
+	}
 
-	for currentOffset < footerOffset {
-		// Read index entry length
-		var length int64
-		if err := binary.Read(file, binary.LittleEndian, &length); err != nil {
-			return nil, fmt.Errorf("failed to read index entry length: %w", err)
-		}
-		currentOffset += 8
+	file, err := sst.storage.Open(sst.fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSTable: %w", err)
+	}
+	defer file.Close()
 
-		// Read index entry data
-		data := make([]byte, length)
-		if _, err := file.Read(data); err != nil {
-			return nil, fmt.Errorf("failed to read index entry data: %w", err)
+	var all []Entry
+	for _, ie := range sst.index {
+		raw, err := readBlock(file, sst.fd, ie.Handle)
+		if err != nil {
+			return nil, err
 		}
-		currentOffset += length
-
-		var idxEntry IndexEntry
-		if err := json.Unmarshal(data, &idxEntry); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal index entry: %w", err)
+		entries, err := decodeBlock(raw)
+		if err != nil {
+			return nil, &ErrCorrupted{FileDesc: sst.fd, Reason: err.Error()}
 		}
-
-		index = append(index, idxEntry)
+		all = append(all, entries...)
 	}
 
-	return &SSTable{
-		FilePath: filePath,
-		index:    index,
-		footer:   footer,
-	}, nil
+	return all, nil
 }
 
-// Get retrieves a value by key from the SSTable
-// Returns (value, exists, error) where exists=true even for tombstones
-// Check if value is empty and exists=true to detect tombstones
-func (sst *SSTable) Get(key string) (string, bool, error) {
-	file, err := os.Open(sst.FilePath)
+// KeyRange returns the smallest and largest key stored in the table. The
+// result is computed from the table's full contents on first call and
+// cached, since leveled compaction consults it repeatedly to decide which
+// SSTables overlap a given key range.
+func (sst *SSTable) KeyRange() (string, string, error) {
+	if sst.haveKeyRange {
+		return sst.minKey, sst.maxKey, nil
+	}
+
+	entries, err := sst.GetAllEntries()
 	if err != nil {
-		return "", false, fmt.Errorf("failed to open SSTable: %w", err)
+		return "", "", err
+	}
+	if len(entries) == 0 {
+		return "", "", nil
 	}
-	defer file.Close()
 
-	// Find the index entry to start scanning from
-	startOffset := int64(0)
-	endOffset := sst.footer.IndexOffset
-
-	// Binary search in sparse index to find starting point
-	if len(sst.index) > 0 {
-		idx := sort.Search(len(sst.index), func(i int) bool {
-			return sst.index[i].Key >= key
-		})
-
-		if idx < len(sst.index) {
-			if sst.index[idx].Key == key {
-				// Direct hit in index
-				startOffset = sst.index[idx].Offset
-			} else if idx > 0 {
-				// Start from previous index entry
-				startOffset = sst.index[idx-1].Offset
-			}
-			// Set end offset to next index entry if exists
-			if idx+1 < len(sst.index) {
-				endOffset = sst.index[idx+1].Offset
-			}
-		} else if len(sst.index) > 0 {
-			// Key might be after last index entry
-			startOffset = sst.index[len(sst.index)-1].Offset
+	minKey, maxKey := entries[0].Key, entries[0].Key
+	for _, e := range entries[1:] {
+		if e.Key < minKey {
+			minKey = e.Key
+		}
+		if e.Key > maxKey {
+			maxKey = e.Key
 		}
 	}
 
-	// Scan from startOffset to endOffset
-	if _, err := file.Seek(startOffset, 0); err != nil {
-		return "", false, fmt.Errorf("failed to seek: %w", err)
+	sst.minKey, sst.maxKey, sst.haveKeyRange = minKey, maxKey, true
+	return minKey, maxKey, nil
+}
+
+// writeBlock Snappy-compresses raw if that would shrink it, writes whichever
+// is smaller followed by a 1-byte compression type and a CRC32C checksum
+// over (payload+type), and returns a handle describing where it landed.
+func writeBlock(file storage.Writer, offset int64, raw []byte) (BlockHandle, error) {
+	payload := raw
+	compressionType := compressionNone
+
+	if compressed := snappy.Encode(raw); len(compressed) < len(raw) {
+		payload = compressed
+		compressionType = compressionSnappy
 	}
 
-	currentOffset := startOffset
-	for currentOffset < endOffset {
-		// Read entry length
-		var length int64
-		if err := binary.Read(file, binary.LittleEndian, &length); err != nil {
-			// End of data section
-			break
-		}
-		currentOffset += 8
+	hasher := crc32.New(crcTable)
+	hasher.Write(payload)
+	hasher.Write([]byte{compressionType})
+	checksum := hasher.Sum32()
 
-		// Read entry data
-		data := make([]byte, length)
-		if _, err := file.Read(data); err != nil {
-			return "", false, fmt.Errorf("failed to read entry: %w", err)
-		}
-		currentOffset += length
+	if _, err := file.Write(payload); err != nil {
+		return BlockHandle{}, err
+	}
+	if _, err := file.Write([]byte{compressionType}); err != nil {
+		return BlockHandle{}, err
+	}
+	var checksumBuf [4]byte
+	binary.LittleEndian.PutUint32(checksumBuf[:], checksum)
+	if _, err := file.Write(checksumBuf[:]); err != nil {
+		return BlockHandle{}, err
+	}
 
-		var entry Entry
-		if err := json.Unmarshal(data, &entry); err != nil {
-			return "", false, fmt.Errorf("failed to unmarshal entry: %w", err)
-		}
+	return BlockHandle{Offset: offset, Length: int64(len(payload))}, nil
+}
 
-		// Check if we found the key
-		if entry.Key == key {
-			if entry.Deleted {
-				// Return exists=true for tombstones so caller knows to stop searching
-				return "", true, nil
-			}
-			return entry.Value, true, nil
-		}
+// readBlock reads the block at handle, verifies its CRC32C checksum, and
+// decompresses it if necessary, returning the raw (pre-decodeBlock) bytes.
+func readBlock(file storage.Reader, fd storage.FileDesc, handle BlockHandle) ([]byte, error) {
+	buf := make([]byte, handle.Length+blockTrailerSize)
+	if _, err := file.ReadAt(buf, handle.Offset); err != nil {
+		return nil, fmt.Errorf("failed to read block at offset %d: %w", handle.Offset, err)
+	}
 
-		// Since entries are sorted, if we passed the key, it doesn't exist
-		if entry.Key > key {
-			return "", false, nil
-		}
+	payload := buf[:handle.Length]
+	compressionType := buf[handle.Length]
+	storedChecksum := binary.LittleEndian.Uint32(buf[handle.Length+1:])
+
+	hasher := crc32.New(crcTable)
+	hasher.Write(payload)
+	hasher.Write([]byte{compressionType})
+	if hasher.Sum32() != storedChecksum {
+		return nil, &ErrCorrupted{FileDesc: fd, Reason: fmt.Sprintf("checksum mismatch in block at offset %d", handle.Offset)}
 	}
 
-	return "", false, nil
+	switch compressionType {
+	case compressionNone:
+		return payload, nil
+	case compressionSnappy:
+		decoded, err := snappy.Decode(payload)
+		if err != nil {
+			return nil, &ErrCorrupted{FileDesc: fd, Reason: fmt.Sprintf("snappy decode failed for block at offset %d: %v", handle.Offset, err)}
+		}
+		return decoded, nil
+	default:
+		return nil, &ErrCorrupted{FileDesc: fd, Reason: fmt.Sprintf("unknown compression type %d for block at offset %d", compressionType, handle.Offset)}
+	}
 }
 
-// GetAllEntries returns all entries in the SSTable
-func (sst *SSTable) GetAllEntries() ([]Entry, error) {
-	file, err := os.Open(sst.FilePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open SSTable: %w", err)
+// encodeIndexBlock serializes index into a flat sequence of
+// (keyLen, key, offset, length) records. The index is small relative to the
+// data blocks it describes, so unlike encodeBlock it isn't prefix-
+// compressed.
+func encodeIndexBlock(index []IndexEntry) []byte {
+	var buf []byte
+	var varintBuf [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(varintBuf[:], uint64(len(index)))
+	buf = append(buf, varintBuf[:n]...)
+
+	for _, ie := range index {
+		n := binary.PutUvarint(varintBuf[:], uint64(len(ie.Key)))
+		buf = append(buf, varintBuf[:n]...)
+		buf = append(buf, ie.Key...)
+
+		var handleBuf [16]byte
+		binary.LittleEndian.PutUint64(handleBuf[0:8], uint64(ie.Handle.Offset))
+		binary.LittleEndian.PutUint64(handleBuf[8:16], uint64(ie.Handle.Length))
+		buf = append(buf, handleBuf[:]...)
 	}
-	defer file.Close()
 
-	var entries []Entry
-	var currentOffset int64 = 0
+	return buf
+}
 
-	for currentOffset < sst.footer.IndexOffset {
-		// Read entry length
-		var length int64
-		if err := binary.Read(file, binary.LittleEndian, &length); err != nil {
-			break
-		}
-		currentOffset += 8
+func decodeIndexBlock(raw []byte) ([]IndexEntry, error) {
+	count, n := binary.Uvarint(raw)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid index entry count")
+	}
+	raw = raw[n:]
 
-		// Read entry data
-		data := make([]byte, length)
-		if _, err := file.Read(data); err != nil {
-			return nil, fmt.Errorf("failed to read entry: %w", err)
+	index := make([]IndexEntry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		keyLen, n := binary.Uvarint(raw)
+		if n <= 0 || keyLen > uint64(len(raw)) {
+			return nil, fmt.Errorf("invalid index key length")
 		}
-		currentOffset += length
+		raw = raw[n:]
+
+		key := string(raw[:keyLen])
+		raw = raw[keyLen:]
 
-		var entry Entry
-		if err := json.Unmarshal(data, &entry); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal entry: %w", err)
+		if len(raw) < 16 {
+			return nil, fmt.Errorf("truncated index block handle")
 		}
+		offset := int64(binary.LittleEndian.Uint64(raw[0:8]))
+		length := int64(binary.LittleEndian.Uint64(raw[8:16]))
+		raw = raw[16:]
 
-		entries = append(entries, entry)
+		index = append(index, IndexEntry{Key: key, Handle: BlockHandle{Offset: offset, Length: length}})
 	}
 
-	return entries, nil
+	return index, nil
 }
@@ -2,150 +2,450 @@ package sstable
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"math"
 	"sort"
-	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
+
+	"github.com/dukky/toydb/storage"
 )
 
 const (
 	// MemtableFlushThreshold is the size in bytes after which memtable is flushed
 	MemtableFlushThreshold = 1024 * 1024 // 1MB
-	// CompactionThreshold is the number of SSTables that trigger compaction
-	CompactionThreshold = 4
+
+	// maxLevels is the number of levels a database maintains, L0..L6.
+	// Level 6 never compacts further; anything that lands there stays.
+	maxLevels = 7
+
+	// L0CompactionTrigger is the number of SSTables in L0 that triggers a
+	// compaction down into L1. L0 files may have overlapping key ranges
+	// (each is a straight memtable flush), so a compaction always takes
+	// every L0 file at once rather than picking just one.
+	L0CompactionTrigger = 4
+
+	// baseLevelMaxBytes is L1's target size; level i>=1 targets
+	// baseLevelMaxBytes * 10^(i-1), so each level is an order of
+	// magnitude bigger than the one above it.
+	baseLevelMaxBytes = 10 * 1024 * 1024 // 10MB
+
+	// targetOutputFileSize caps how large a single SSTable a compaction
+	// writes into Li+1 before it starts a new output file.
+	targetOutputFileSize = 2 * 1024 * 1024 // 2MiB
 )
 
-// SSTableDB implements a database using SSTables with a memtable
+// Options configures an SSTableDB. The zero value is the default
+// configuration used by NewSSTableDB.
+type Options struct {
+	// DisableBloomFilter skips building a bloom filter for SSTables
+	// flushed or compacted by this DB, trading faster writes for slower
+	// negative lookups.
+	DisableBloomFilter bool
+
+	// AsyncCompaction runs maybeCompact on a background goroutine instead
+	// of inline in Write/Delete/flushMemtable, so a flush that pushes a
+	// level over its budget doesn't make the writer that triggered it
+	// wait for the compaction to finish. Close still waits for any
+	// in-flight compaction before returning.
+	AsyncCompaction bool
+
+	// WALSync fsyncs the WAL after every append (Write, Delete, or
+	// WriteBatch) before it returns, so an acknowledged write is
+	// guaranteed durable against a crash rather than only against an
+	// in-process panic. Off by default, trading that guarantee for
+	// lower write latency.
+	WALSync bool
+}
+
+// SSTableDB implements a database using SSTables with a memtable, leveled
+// on disk L0..L(maxLevels-1): L0 holds raw memtable flushes and may have
+// overlapping key ranges; every level below it maintains disjoint key
+// ranges among its SSTables, with per-level size targets growing by a
+// factor of 10. A MANIFEST file tracks which SSTable belongs to which
+// level; see manifest.go. The memtable itself is protected by a
+// write-ahead log, replayed on open to recover writes a crash lost before
+// they reached disk as an SSTable; see wal.go. NewSSTableDBWithOptions
+// holds storage's Lock for as long as the DB is open, so a second DB can't
+// open the same storage underneath it and corrupt its files; Close
+// releases it.
 type SSTableDB struct {
-	mu          sync.RWMutex
-	dataDir     string
-	memtable    *Memtable
-	sstables    []*SSTable // Ordered from newest to oldest
-	nextSSTableID int
+	mu       sync.RWMutex
+	storage  storage.Storage
+	lock     storage.Releaser // held for the DB's lifetime; see storage.Storage.Lock
+	memtable *Memtable
+	levels   [][]*SSTable // levels[0] is L0, newest flush first; levels[i>=1] sorted by key range
+	manifest *manifest
+	options  Options
+
+	nextFileID      int
+	compactCursor   map[int]string // level -> max key of the last round-robin compaction input
+	compactionCount int64          // number of compactLevel runs that actually merged files
+
+	// wal is the write-ahead log backing the current memtable, or nil if
+	// nothing has been written to it yet. It's created lazily on the first
+	// Write/Delete/WriteBatch after DB open or the last flush, and removed
+	// once that data is safely on disk; see appendWALBatch and
+	// flushMemtable.
+	wal *wal
+
+	seq           uint64   // sequence number assigned to the most recent write
+	liveSnapshots []uint64 // sorted ascending; held by every open Snapshot
+
+	// compactSignal and compactDone drive the background compaction
+	// goroutine when options.AsyncCompaction is set; both are nil
+	// otherwise. See runCompactionLoop.
+	compactSignal chan struct{}
+	compactDone   chan struct{}
+	compactWG     sync.WaitGroup
+	compactErr    error // last error maybeCompact returned on the background goroutine, if any
+}
+
+// NewSSTableDB creates a new SSTable-based database using the default
+// options (bloom filters enabled) backed by s. See NewSSTableDBWithOptions
+// to customize it.
+func NewSSTableDB(s storage.Storage) (*SSTableDB, error) {
+	return NewSSTableDBWithOptions(s, Options{})
 }
 
-// NewSSTableDB creates a new SSTable-based database
-func NewSSTableDB(dataDir string) (*SSTableDB, error) {
-	// Create data directory if it doesn't exist
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create data directory: %w", err)
+// NewSSTableDBWithOptions creates a new SSTable-based database, backed by
+// s, configured by opts.
+func NewSSTableDBWithOptions(s storage.Storage, opts Options) (*SSTableDB, error) {
+	lock, err := s.Lock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock storage: %w", err)
 	}
 
 	db := &SSTableDB{
-		dataDir:     dataDir,
-		memtable:    NewMemtable(),
-		sstables:    make([]*SSTable, 0),
-		nextSSTableID: 0,
+		storage:       s,
+		lock:          lock,
+		memtable:      NewMemtable(),
+		levels:        make([][]*SSTable, maxLevels),
+		compactCursor: make(map[int]string),
+		options:       opts,
 	}
 
-	// Load existing SSTables
-	if err := db.loadSSTables(); err != nil {
+	if err := db.loadLevels(); err != nil {
+		lock.Release()
+		return nil, err
+	}
+	if err := db.recoverWAL(); err != nil {
+		lock.Release()
 		return nil, err
 	}
 
+	if opts.AsyncCompaction {
+		db.compactSignal = make(chan struct{}, 1)
+		db.compactDone = make(chan struct{})
+		db.compactWG.Add(1)
+		go db.runCompactionLoop()
+	}
+
 	return db, nil
 }
 
-// loadSSTables loads all existing SSTable files from the data directory
-func (db *SSTableDB) loadSSTables() error {
-	files, err := os.ReadDir(db.dataDir)
-	if err != nil {
-		return fmt.Errorf("failed to read data directory: %w", err)
+// runCompactionLoop runs maybeCompact each time flushMemtable signals that a
+// level might now be over its budget, until Close closes compactDone. Only
+// started when options.AsyncCompaction is set.
+func (db *SSTableDB) runCompactionLoop() {
+	defer db.compactWG.Done()
+	for {
+		select {
+		case <-db.compactDone:
+			// A signal still queued when Close arrives is run before the
+			// loop exits, rather than dropped.
+			select {
+			case <-db.compactSignal:
+			default:
+				return
+			}
+		case <-db.compactSignal:
+		}
+		db.mu.Lock()
+		if err := db.maybeCompact(); err != nil {
+			db.compactErr = err
+		}
+		db.mu.Unlock()
 	}
+}
 
-	var sstablePaths []string
-	maxID := -1
+// CompactionError returns the last error the background compaction
+// goroutine hit, if any. Always nil when options.AsyncCompaction is unset,
+// since maybeCompact then runs inline and its error surfaces directly from
+// Write/Delete/Flush instead.
+func (db *SSTableDB) CompactionError() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.compactErr
+}
 
-	for _, file := range files {
-		if file.IsDir() {
+// signalCompaction wakes the background compaction goroutine, without
+// blocking if it's already got a pending signal queued.
+func (db *SSTableDB) signalCompaction() {
+	select {
+	case db.compactSignal <- struct{}{}:
+	default:
+	}
+}
+
+// recoverWAL replays every WAL file left over from before a crash or
+// ungraceful close into the memtable, in file-number order, then flushes
+// that memtable to disk immediately and deletes the WAL(s) - simpler than
+// keeping the recovered data in memory and reopening one of the old WALs
+// for further appends, and flushMemtable already does the right thing if
+// nothing was recovered.
+func (db *SSTableDB) recoverWAL() error {
+	fds, err := db.storage.List(storage.TypeLog)
+	if err != nil {
+		return fmt.Errorf("failed to list WAL files: %w", err)
+	}
+
+	var replayed []storage.FileDesc
+	for _, fd := range fds {
+		records, found, err := replayWAL(db.storage, fd)
+		if err != nil {
+			return fmt.Errorf("failed to recover WAL %s: %w", fd, err)
+		}
+		if !found {
 			continue
 		}
+		replayed = append(replayed, fd)
+		for _, r := range records {
+			if r.Deleted {
+				db.memtable.Delete(r.Key, r.Seq)
+			} else {
+				db.memtable.Put(r.Key, r.Value, r.Seq)
+			}
+			if r.Seq > db.seq {
+				db.seq = r.Seq
+			}
+		}
+	}
+
+	if err := db.flushMemtable(); err != nil {
+		return err
+	}
+	for _, fd := range replayed {
+		db.storage.Remove(fd)
+	}
+	return nil
+}
 
-		// Look for files matching pattern: sstable_XXXXXX.sst
-		if strings.HasPrefix(file.Name(), "sstable_") && strings.HasSuffix(file.Name(), ".sst") {
-			sstablePaths = append(sstablePaths, filepath.Join(db.dataDir, file.Name()))
+// writeOptions returns the WriteOptions this DB uses for new SSTables.
+func (db *SSTableDB) writeOptions() WriteOptions {
+	return WriteOptions{DisableBloomFilter: db.options.DisableBloomFilter}
+}
+
+// loadLevels opens the SSTables recorded live in the MANIFEST and assigns
+// each to its level. If no MANIFEST exists yet - a brand new data
+// directory, or one written before leveled compaction existed - it adopts
+// whatever sstable_*.sst files are already there as a single L0 generation
+// and bootstraps a MANIFEST so every later session has one to replay.
+func (db *SSTableDB) loadLevels() error {
+	m, err := newManifest(db.storage)
+	if err != nil {
+		return err
+	}
+	db.manifest = m
+
+	levelFiles, nextFileID, found, err := db.manifest.replay()
+	if err != nil {
+		return err
+	}
+	if !found {
+		return db.bootstrapManifest()
+	}
 
-			// Extract ID to determine next ID
-			idStr := strings.TrimPrefix(file.Name(), "sstable_")
-			idStr = strings.TrimSuffix(idStr, ".sst")
-			if id, err := strconv.Atoi(idStr); err == nil && id > maxID {
-				maxID = id
+	live := make(map[int]bool)
+	for level, nums := range levelFiles {
+		for _, num := range nums {
+			live[num] = true
+			fd := storage.FileDesc{Type: storage.TypeSSTable, Num: num}
+			sst, err := OpenSSTable(db.storage, fd)
+			if err != nil {
+				return fmt.Errorf("failed to open SSTable %s: %w", fd, err)
 			}
+			db.levels[level] = append(db.levels[level], sst)
+			db.trackSeq(sst)
+		}
+	}
+	// L0 files were appended to the log in the order they were flushed
+	// (oldest first); reads expect L0 newest first.
+	reverseSSTables(db.levels[0])
+	for level := 1; level < maxLevels; level++ {
+		if err := sortLevelByKeyRange(db.levels[level]); err != nil {
+			return err
 		}
 	}
 
-	// Sort by ID (newest first)
-	sort.Slice(sstablePaths, func(i, j int) bool {
-		return sstablePaths[i] > sstablePaths[j]
-	})
+	if err := db.removeOrphanFiles(live); err != nil {
+		return err
+	}
 
-	// Load SSTables
-	for _, path := range sstablePaths {
-		sst, err := OpenSSTable(path)
+	db.nextFileID = nextFileID
+	return nil
+}
+
+// bootstrapManifest adopts any TypeSSTable files already in storage - left
+// over from before this package tracked levels - as L0, and records them
+// in a freshly created MANIFEST.
+func (db *SSTableDB) bootstrapManifest() error {
+	fds, err := db.storage.List(storage.TypeSSTable)
+	if err != nil {
+		return fmt.Errorf("failed to list SSTable files: %w", err)
+	}
+
+	maxID := -1
+	for _, fd := range fds {
+		if fd.Num > maxID {
+			maxID = fd.Num
+		}
+	}
+
+	var added []manifestFile
+	for _, fd := range fds { // List returns ascending Num order: oldest first
+		sst, err := OpenSSTable(db.storage, fd)
 		if err != nil {
-			return fmt.Errorf("failed to open SSTable %s: %w", path, err)
+			return fmt.Errorf("failed to open SSTable %s: %w", fd, err)
 		}
-		db.sstables = append(db.sstables, sst)
+		db.trackSeq(sst)
+		db.levels[0] = append([]*SSTable{sst}, db.levels[0]...) // newest first
+		added = append(added, manifestFile{Level: 0, Num: fd.Num})
+	}
+
+	db.nextFileID = maxID + 1
+	if len(added) == 0 {
+		return nil
 	}
+	return db.manifest.append(manifestEdit{AddedFiles: added, NextFileID: db.nextFileID})
+}
 
-	db.nextSSTableID = maxID + 1
+// trackSeq advances db.seq past every version stored in sst, so a reopened
+// database keeps assigning fresh sequence numbers rather than reusing ones
+// already on disk.
+func (db *SSTableDB) trackSeq(sst *SSTable) {
+	entries, err := sst.GetAllEntries()
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Seq > db.seq {
+			db.seq = entry.Seq
+		}
+	}
+}
 
+// removeOrphanFiles deletes any TypeSSTable file in storage that isn't in
+// live: output files a crashed compaction wrote but never registered in
+// the MANIFEST, or input files it registered as removed but never got
+// around to deleting.
+func (db *SSTableDB) removeOrphanFiles(live map[int]bool) error {
+	fds, err := db.storage.List(storage.TypeSSTable)
+	if err != nil {
+		return fmt.Errorf("failed to list SSTable files: %w", err)
+	}
+	for _, fd := range fds {
+		if !live[fd.Num] {
+			db.storage.Remove(fd)
+		}
+	}
 	return nil
 }
 
+// newFileDesc allocates the next globally unique SSTable FileDesc.
+func (db *SSTableDB) newFileDesc() storage.FileDesc {
+	fd := storage.FileDesc{Type: storage.TypeSSTable, Num: db.nextFileID}
+	db.nextFileID++
+	return fd
+}
+
+// newWALFileDesc allocates the next globally unique WAL FileDesc, from the
+// same counter as newFileDesc; sharing it is safe since a FileDesc's Type
+// already keeps WAL and SSTable files apart.
+func (db *SSTableDB) newWALFileDesc() storage.FileDesc {
+	fd := storage.FileDesc{Type: storage.TypeLog, Num: db.nextFileID}
+	db.nextFileID++
+	return fd
+}
+
+// appendWAL is appendWALBatch for a single record.
+func (db *SSTableDB) appendWAL(r walRecord) error {
+	return db.appendWALBatch([]walRecord{r})
+}
+
+// appendWALBatch appends records to the WAL backing the current memtable,
+// opening a fresh one first if the last flush (or DB open) left none
+// active. Caller must hold db.mu.
+func (db *SSTableDB) appendWALBatch(records []walRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if db.wal == nil {
+		db.wal = newWAL(db.storage, db.newWALFileDesc(), db.options.WALSync)
+	}
+	return db.wal.appendBatch(records)
+}
+
 // Write writes a key-value pair to the database
 func (db *SSTableDB) Write(key, value string) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	// Write to memtable
-	db.memtable.Put(key, value)
+	db.seq++
+	if err := db.appendWAL(walRecord{Seq: db.seq, Key: key, Value: value}); err != nil {
+		return fmt.Errorf("failed to append to WAL: %w", err)
+	}
+	db.memtable.Put(key, value, db.seq)
 
-	// Flush memtable if it exceeds threshold
 	if db.memtable.Size() >= MemtableFlushThreshold {
 		if err := db.flushMemtable(); err != nil {
 			return fmt.Errorf("failed to flush memtable: %w", err)
 		}
-
-		// Check if compaction is needed
-		if len(db.sstables) >= CompactionThreshold {
-			if err := db.compact(); err != nil {
-				return fmt.Errorf("failed to compact: %w", err)
-			}
-		}
 	}
 
 	return nil
 }
 
-// Read reads a value by key from the database
+// Read reads the latest value for key from the database.
 func (db *SSTableDB) Read(key string) (string, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	// Check memtable first
-	if value, found := db.memtable.Get(key); found {
-		return value, nil
+	entry, found, err := db.readAtSeq(key, math.MaxUint64)
+	if err != nil {
+		return "", err
+	}
+	if !found || entry.Deleted {
+		return "", fmt.Errorf("key not found: %s", key)
 	}
+	return entry.Value, nil
+}
 
-	// Check SSTables from newest to oldest
-	for _, sst := range db.sstables {
-		value, found, err := sst.Get(key)
-		if err != nil {
-			return "", fmt.Errorf("failed to read from SSTable: %w", err)
-		}
-		if found {
-			// If found but value is empty, it's a tombstone
-			if value == "" {
-				return "", fmt.Errorf("key not found: %s", key)
+// readAtSeq returns the newest version of key with a sequence number no
+// greater than maxSeq, checking the memtable and then every SSTable in
+// every level and keeping whichever version found has the highest
+// sequence number. Levels L1+ are disjoint, so at most one of their
+// SSTables can ever match; L0 may hold several overlapping versions,
+// which is exactly why the comparison is by sequence number rather than
+// by "first source found".
+func (db *SSTableDB) readAtSeq(key string, maxSeq uint64) (Entry, bool, error) {
+	if entry, found := db.memtable.GetAtSeq(key, maxSeq); found {
+		return entry, true, nil
+	}
+
+	var best Entry
+	haveBest := false
+	for _, level := range db.levels {
+		for _, sst := range level {
+			entry, found, err := sst.GetAtSeq(key, maxSeq)
+			if err != nil {
+				return Entry{}, false, fmt.Errorf("failed to read from SSTable: %w", err)
+			}
+			if found && (!haveBest || entry.Seq > best.Seq) {
+				best, haveBest = entry, true
 			}
-			return value, nil
 		}
 	}
-
-	return "", fmt.Errorf("key not found: %s", key)
+	return best, haveBest, nil
 }
 
 // Delete marks a key as deleted in the database
@@ -153,141 +453,532 @@ func (db *SSTableDB) Delete(key string) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	// Write tombstone to memtable
-	db.memtable.Delete(key)
+	db.seq++
+	if err := db.appendWAL(walRecord{Seq: db.seq, Key: key, Deleted: true}); err != nil {
+		return fmt.Errorf("failed to append to WAL: %w", err)
+	}
+	db.memtable.Delete(key, db.seq)
 
-	// Flush memtable if it exceeds threshold
 	if db.memtable.Size() >= MemtableFlushThreshold {
 		if err := db.flushMemtable(); err != nil {
 			return fmt.Errorf("failed to flush memtable: %w", err)
 		}
-
-		// Check if compaction is needed
-		if len(db.sstables) >= CompactionThreshold {
-			if err := db.compact(); err != nil {
-				return fmt.Errorf("failed to compact: %w", err)
-			}
-		}
 	}
 
 	return nil
 }
 
-// flushMemtable writes the current memtable to disk as an SSTable
+// flushMemtable writes the current memtable to disk as a new L0 SSTable,
+// deletes the WAL that protected it (its data is now durable in the
+// SSTable itself), then runs whatever compactions that flush's L0 arrival
+// (or a level already over its size target) now calls for.
 func (db *SSTableDB) flushMemtable() error {
 	if db.memtable.IsEmpty() {
 		return nil
 	}
 
-	// Get sorted entries from memtable
 	entries := db.memtable.GetSortedEntries()
 
-	// Generate SSTable filename
-	sstablePath := filepath.Join(db.dataDir, fmt.Sprintf("sstable_%06d.sst", db.nextSSTableID))
-	db.nextSSTableID++
-
-	// Write SSTable to disk
-	if err := WriteSSTable(sstablePath, entries); err != nil {
+	fd := db.newFileDesc()
+	if err := WriteSSTableWithOptions(db.storage, fd, entries, db.writeOptions()); err != nil {
 		return err
 	}
 
-	// Open the newly created SSTable
-	sst, err := OpenSSTable(sstablePath)
+	sst, err := OpenSSTable(db.storage, fd)
 	if err != nil {
 		return err
 	}
 
-	// Add to SSTables list (newest first)
-	db.sstables = append([]*SSTable{sst}, db.sstables...)
+	db.levels[0] = append([]*SSTable{sst}, db.levels[0]...)
+	if err := db.manifest.append(manifestEdit{
+		AddedFiles: []manifestFile{{Level: 0, Num: fd.Num}},
+		NextFileID: db.nextFileID,
+	}); err != nil {
+		return fmt.Errorf("failed to update manifest: %w", err)
+	}
 
-	// Clear memtable
 	db.memtable.Clear()
 
-	return nil
-}
+	if db.wal != nil {
+		db.storage.Remove(db.wal.fd)
+		db.wal = nil
+	}
 
-// compact merges all SSTables into a single SSTable
-func (db *SSTableDB) compact() error {
-	if len(db.sstables) < 2 {
+	if db.options.AsyncCompaction {
+		db.signalCompaction()
 		return nil
 	}
+	return db.maybeCompact()
+}
+
+// minLiveSnapshotSeq returns the smallest sequence number among open
+// snapshots and whether any are open at all. Compaction uses this as its
+// cutoff: any version at or above it might still be read through a
+// snapshot and must be kept.
+func (db *SSTableDB) minLiveSnapshotSeq() (uint64, bool) {
+	if len(db.liveSnapshots) == 0 {
+		return 0, false
+	}
+	return db.liveSnapshots[0], true
+}
+
+// compactVersions collapses the versions of each key in all (sorted by key,
+// then by descending Seq) down to what's actually still needed.
+//
+// With no live snapshots, only the newest version of each key matters - a
+// plain last-write-wins collapse, dropping the key entirely if that
+// version is a tombstone.
+//
+// With live snapshots, a version is kept if it's no older than the oldest
+// live snapshot (Seq >= cutoff, where cutoff = the oldest live snapshot's seq)
+// since some snapshot might still need to distinguish it from the next
+// one, plus exactly one further "floor" version below cutoff - the
+// newest one the oldest live snapshot can actually see. Every older
+// version is now unreachable by any live snapshot and is dropped. The
+// floor version is kept even if it's a tombstone, since a live snapshot
+// at or above its seq needs to see the key as deleted.
+func compactVersions(all []Entry, cutoff uint64, hasLiveSnapshots bool) []Entry {
+	var result []Entry
+
+	i := 0
+	for i < len(all) {
+		key := all[i].Key
+		j := i
+		for j < len(all) && all[j].Key == key {
+			j++
+		}
+		versions := all[i:j]
+		i = j
+
+		if !hasLiveSnapshots {
+			if !versions[0].Deleted {
+				result = append(result, versions[0])
+			}
+			continue
+		}
+
+		keptFloor := false
+		for _, e := range versions {
+			switch {
+			case e.Seq >= cutoff:
+				result = append(result, e)
+			case !keptFloor:
+				result = append(result, e)
+				keptFloor = true
+			}
+		}
+	}
 
-	// Collect all entries from all SSTables
-	allEntries := make(map[string]Entry)
+	return result
+}
 
-	// Read from oldest to newest (reversed order)
-	for i := len(db.sstables) - 1; i >= 0; i-- {
-		entries, err := db.sstables[i].GetAllEntries()
+// maybeCompact runs compaction passes, lowest level first, until no level
+// exceeds its trigger - L0's file count or Li's (i>=1) target byte size.
+// Compacting the lowest such level first keeps data draining toward the
+// bottom of the tree instead of piling up at L0.
+func (db *SSTableDB) maybeCompact() error {
+	for pass := 0; pass < maxLevels*2; pass++ {
+		level := db.levelNeedingCompaction()
+		if level < 0 {
+			return nil
+		}
+		var err error
+		if level == 0 {
+			err = db.compactLevel(0, allSSTables)
+		} else {
+			err = db.compactLevel(level, db.roundRobinInput(level))
+		}
 		if err != nil {
-			return fmt.Errorf("failed to read SSTable entries: %w", err)
+			return err
 		}
+	}
+	return nil
+}
 
-		// Latest value for each key wins
-		for _, entry := range entries {
-			allEntries[entry.Key] = entry
+func (db *SSTableDB) levelNeedingCompaction() int {
+	if len(db.levels[0]) >= L0CompactionTrigger {
+		return 0
+	}
+	for level := 1; level < maxLevels-1; level++ {
+		if levelSizeBytes(db.levels[level]) > targetLevelSizeBytes(level) {
+			return level
 		}
 	}
+	return -1
+}
 
-	// Convert map to sorted slice, excluding deleted entries
-	var compactedEntries []Entry
-	for _, entry := range allEntries {
-		if !entry.Deleted {
-			compactedEntries = append(compactedEntries, entry)
+func targetLevelSizeBytes(level int) int64 {
+	target := int64(baseLevelMaxBytes)
+	for i := 1; i < level; i++ {
+		target *= 10
+	}
+	return target
+}
+
+func levelSizeBytes(tables []*SSTable) int64 {
+	var total int64
+	for _, sst := range tables {
+		total += sst.Size()
+	}
+	return total
+}
+
+// allSSTables selects every table in a level as compaction input. Used for
+// L0 (always compacted as a whole, since its files may overlap) and for a
+// forced full Compact().
+func allSSTables(tables []*SSTable) []*SSTable {
+	return append([]*SSTable{}, tables...)
+}
+
+// roundRobinInput returns a selector that picks a single SSTable from
+// level to compact: the first one (in ascending key order) whose range
+// lies above the last compaction's cursor, wrapping around to the start
+// once the cursor reaches the end. This spreads compactions evenly across
+// a level's key range instead of always picking the same file.
+func (db *SSTableDB) roundRobinInput(level int) func([]*SSTable) []*SSTable {
+	return func(tables []*SSTable) []*SSTable {
+		if len(tables) == 0 {
+			return nil
+		}
+		cursor := db.compactCursor[level]
+		for _, sst := range tables {
+			if _, maxKey, err := sst.KeyRange(); err == nil && maxKey > cursor {
+				return []*SSTable{sst}
+			}
 		}
+		return []*SSTable{tables[0]}
 	}
+}
 
-	if len(compactedEntries) == 0 {
-		// All entries were deleted, just remove all SSTables
-		for _, sst := range db.sstables {
-			os.Remove(sst.FilePath)
+// overlappingInputs returns a selector that picks every SSTable in a level
+// whose key range intersects [lo, hi]. A nil bound leaves that side
+// unrestricted. Used for CompactRange, where the caller names the range
+// to compact rather than leaving the choice to the usual triggers.
+func overlappingInputs(lo, hi *string) func([]*SSTable) []*SSTable {
+	return func(tables []*SSTable) []*SSTable {
+		var picked []*SSTable
+		for _, sst := range tables {
+			minKey, maxKey, err := sst.KeyRange()
+			if err != nil {
+				continue
+			}
+			if lo != nil && maxKey < *lo {
+				continue
+			}
+			if hi != nil && minKey > *hi {
+				continue
+			}
+			picked = append(picked, sst)
 		}
-		db.sstables = nil
+		return picked
+	}
+}
+
+// compactLevel compacts whatever selectInputs picks from level with every
+// overlapping SSTable in level+1, dropping tombstones and versions no
+// live snapshot can still see, and writes the result into level+1.
+func (db *SSTableDB) compactLevel(level int, selectInputs func([]*SSTable) []*SSTable) error {
+	if level+1 >= maxLevels {
 		return nil
 	}
 
-	// Sort entries by key
-	sort.Slice(compactedEntries, func(i, j int) bool {
-		return compactedEntries[i].Key < compactedEntries[j].Key
-	})
+	fromLevel := selectInputs(db.levels[level])
+	if len(fromLevel) == 0 {
+		return nil
+	}
+
+	lo, hi, err := keyRangeOf(fromLevel)
+	if err != nil {
+		return fmt.Errorf("failed to read compaction input range: %w", err)
+	}
+	if level > 0 {
+		db.compactCursor[level] = hi
+	}
 
-	// Create new compacted SSTable with timestamp to avoid conflicts
-	compactedPath := filepath.Join(db.dataDir, fmt.Sprintf("sstable_%06d.sst", db.nextSSTableID))
-	db.nextSSTableID++
+	overlapping, remaining := partitionByRange(db.levels[level+1], lo, hi)
 
-	if err := WriteSSTable(compactedPath, compactedEntries); err != nil {
+	inputs := append(append([]*SSTable{}, fromLevel...), overlapping...)
+	all, err := readAllEntries(inputs)
+	if err != nil {
 		return err
 	}
+	sortEntriesForCompaction(all)
+
+	cutoff, hasLiveSnapshots := db.minLiveSnapshotSeq()
+	merged := compactVersions(all, cutoff, hasLiveSnapshots)
 
-	// Open the compacted SSTable
-	compactedSST, err := OpenSSTable(compactedPath)
+	outputs, err := db.writeCompactionOutputs(merged)
 	if err != nil {
 		return err
 	}
 
-	// Remove old SSTable files
-	for _, sst := range db.sstables {
-		os.Remove(sst.FilePath)
+	var added []manifestFile
+	for _, sst := range outputs {
+		added = append(added, manifestFile{Level: level + 1, Num: sst.FileDesc().Num})
+	}
+	if err := db.manifest.append(manifestEdit{
+		AddedFiles:   added,
+		RemovedFiles: append(fileNums(fromLevel), fileNums(overlapping)...),
+		NextFileID:   db.nextFileID,
+	}); err != nil {
+		return fmt.Errorf("failed to update manifest: %w", err)
+	}
+
+	db.levels[level] = subtractSSTables(db.levels[level], fromLevel)
+	db.levels[level+1] = append(remaining, outputs...)
+	if err := sortLevelByKeyRange(db.levels[level+1]); err != nil {
+		return err
+	}
+
+	for _, sst := range inputs {
+		db.removeSSTable(sst)
 	}
 
-	// Replace with compacted SSTable
-	db.sstables = []*SSTable{compactedSST}
+	db.compactionCount++
 
 	return nil
 }
 
-// Compact manually triggers compaction of all SSTables
+// removeSSTable removes sst's file now if nothing is reading it, or marks
+// it for removal by the last open iterator's Close otherwise - an iterator
+// from NewIterator can outlive the db.mu hold that picked sst as a
+// compaction input, so its file must stay intact until that iterator is
+// done with it. The store-then-recheck order mirrors release's, so the two
+// can race without either side missing the other's update.
+func (db *SSTableDB) removeSSTable(sst *SSTable) {
+	atomic.StoreInt32(&sst.pendingRemoval, 1)
+	if atomic.LoadInt32(&sst.refs) == 0 && atomic.CompareAndSwapInt32(&sst.pendingRemoval, 1, 0) {
+		db.storage.Remove(sst.FileDesc())
+	}
+}
+
+// writeCompactionOutputs writes entries (already key-sorted) into one or
+// more new SSTables, starting a new output once the one in progress
+// reaches targetOutputFileSize, without ever splitting the versions of a
+// single key across two outputs.
+func (db *SSTableDB) writeCompactionOutputs(entries []Entry) ([]*SSTable, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	var outputs []*SSTable
+	var pending []Entry
+	pendingSize := 0
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		fd := db.newFileDesc()
+		if err := WriteSSTableWithOptions(db.storage, fd, pending, db.writeOptions()); err != nil {
+			return err
+		}
+		sst, err := OpenSSTable(db.storage, fd)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, sst)
+		pending = nil
+		pendingSize = 0
+		return nil
+	}
+
+	for i, entry := range entries {
+		pending = append(pending, entry)
+		pendingSize += len(entry.Key) + len(entry.Value)
+
+		atKeyBoundary := i == len(entries)-1 || entries[i+1].Key != entry.Key
+		if pendingSize >= targetOutputFileSize && atKeyBoundary {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return outputs, nil
+}
+
+// keyRangeOf returns the overall [min, max] key range spanned by tables.
+func keyRangeOf(tables []*SSTable) (string, string, error) {
+	lo, hi := "", ""
+	for i, sst := range tables {
+		minKey, maxKey, err := sst.KeyRange()
+		if err != nil {
+			return "", "", err
+		}
+		if i == 0 || minKey < lo {
+			lo = minKey
+		}
+		if i == 0 || maxKey > hi {
+			hi = maxKey
+		}
+	}
+	return lo, hi, nil
+}
+
+// partitionByRange splits tables into those whose key range intersects
+// [lo, hi] and those that don't.
+func partitionByRange(tables []*SSTable, lo, hi string) (overlapping, rest []*SSTable) {
+	for _, sst := range tables {
+		minKey, maxKey, err := sst.KeyRange()
+		if err == nil && maxKey >= lo && minKey <= hi {
+			overlapping = append(overlapping, sst)
+		} else {
+			rest = append(rest, sst)
+		}
+	}
+	return overlapping, rest
+}
+
+// readAllEntries reads every entry out of every table in tables.
+func readAllEntries(tables []*SSTable) ([]Entry, error) {
+	var all []Entry
+	for _, sst := range tables {
+		entries, err := sst.GetAllEntries()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSTable entries: %w", err)
+		}
+		all = append(all, entries...)
+	}
+	return all, nil
+}
+
+// sortEntriesForCompaction orders entries by key ascending, then by
+// sequence number descending, so compactVersions can walk each key's
+// versions newest-first.
+func sortEntriesForCompaction(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		return entries[i].Seq > entries[j].Seq
+	})
+}
+
+// sortLevelByKeyRange sorts a level's SSTables by ascending minimum key,
+// the order that lets partitionByRange and roundRobinInput assume a
+// level's ranges are laid out left to right.
+func sortLevelByKeyRange(tables []*SSTable) error {
+	var rangeErr error
+	sort.Slice(tables, func(i, j int) bool {
+		a, _, err := tables[i].KeyRange()
+		if err != nil {
+			rangeErr = err
+		}
+		b, _, err := tables[j].KeyRange()
+		if err != nil {
+			rangeErr = err
+		}
+		return a < b
+	})
+	return rangeErr
+}
+
+func fileNums(tables []*SSTable) []int {
+	nums := make([]int, len(tables))
+	for i, sst := range tables {
+		nums[i] = sst.FileDesc().Num
+	}
+	return nums
+}
+
+func subtractSSTables(tables, remove []*SSTable) []*SSTable {
+	var result []*SSTable
+	for _, sst := range tables {
+		if !containsSSTable(remove, sst) {
+			result = append(result, sst)
+		}
+	}
+	return result
+}
+
+func containsSSTable(tables []*SSTable, target *SSTable) bool {
+	for _, sst := range tables {
+		if sst == target {
+			return true
+		}
+	}
+	return false
+}
+
+func reverseSSTables(tables []*SSTable) {
+	for i, j := 0, len(tables)-1; i < j; i, j = i+1, j-1 {
+		tables[i], tables[j] = tables[j], tables[i]
+	}
+}
+
+// Compact manually forces every level to compact into the next, regardless
+// of the usual triggers, cascading until all data has settled as deep into
+// the level hierarchy as it will go.
 func (db *SSTableDB) Compact() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	// Flush memtable first
 	if !db.memtable.IsEmpty() {
 		if err := db.flushMemtable(); err != nil {
 			return err
 		}
 	}
 
-	return db.compact()
+	for level := 0; level < maxLevels-1; level++ {
+		for len(db.levels[level]) > 0 {
+			before := len(db.levels[level])
+			if err := db.compactLevel(level, allSSTables); err != nil {
+				return err
+			}
+			if len(db.levels[level]) == before {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// CompactRange manually compacts every level whose key range overlaps
+// [start, end], both bounds inclusive, down into the next level. Either bound may be nil to leave
+// that side unrestricted.
+func (db *SSTableDB) CompactRange(start, end []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.memtable.IsEmpty() {
+		if err := db.flushMemtable(); err != nil {
+			return err
+		}
+	}
+
+	var lo, hi *string
+	if start != nil {
+		s := string(start)
+		lo = &s
+	}
+	if end != nil {
+		s := string(end)
+		hi = &s
+	}
+
+	// Only cascade as deep as the range already has data: find the lowest
+	// level with nothing in [lo, hi] and stop there, rather than chasing
+	// the just-compacted output down through every remaining empty level.
+	selector := overlappingInputs(lo, hi)
+	deepest := -1
+	for level := 0; level < maxLevels-1; level++ {
+		if len(selector(db.levels[level])) > 0 {
+			deepest = level
+		}
+	}
+
+	for level := 0; level <= deepest; level++ {
+		if err := db.compactLevel(level, selector); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Flush manually flushes the memtable to disk
@@ -298,27 +989,122 @@ func (db *SSTableDB) Flush() error {
 	return db.flushMemtable()
 }
 
-// Stats returns statistics about the database
+// Stats returns statistics about the database, including a per-level
+// breakdown of file counts and total bytes on disk.
 func (db *SSTableDB) Stats() map[string]interface{} {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
+	levelStats := make([]map[string]interface{}, len(db.levels))
+	totalFiles := 0
+	var filterRejections int64
+	for i, tables := range db.levels {
+		levelStats[i] = map[string]interface{}{
+			"level": i,
+			"files": len(tables),
+			"bytes": levelSizeBytes(tables),
+		}
+		totalFiles += len(tables)
+		for _, sst := range tables {
+			filterRejections += sst.FilterRejections()
+		}
+	}
+
 	return map[string]interface{}{
-		"memtable_size":   db.memtable.Size(),
-		"num_sstables":    len(db.sstables),
-		"next_sstable_id": db.nextSSTableID,
+		"memtable_size":     db.memtable.Size(),
+		"num_sstables":      totalFiles,
+		"next_sstable_id":   db.nextFileID,
+		"live_snapshots":    len(db.liveSnapshots),
+		"filter_rejections": filterRejections,
+		"compactions_run":   db.compactionCount,
+		"async_compaction":  db.options.AsyncCompaction,
+		"levels":            levelStats,
+	}
+}
+
+// NewIterator returns an Iterator over the database's merged view - the
+// memtable and every SSTable, newest version winning on key collisions and
+// tombstones suppressing older versions - restricted to the half-open
+// range [lower, upper). Either bound may be nil to leave that side
+// unrestricted.
+func (db *SSTableDB) NewIterator(lower, upper []byte) (Iterator, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.newIteratorAtSeq(lower, upper, math.MaxUint64)
+}
+
+// Scan returns every key/value pair in the half-open range [start, end),
+// as of the current database state. It's a convenience wrapper around
+// NewIterator for callers that want the results as a slice rather than
+// driving an Iterator themselves. Pass "" for start or end to leave that
+// side of the range unrestricted.
+func (db *SSTableDB) Scan(start, end string) ([]Entry, error) {
+	var lower, upper []byte
+	if start != "" {
+		lower = []byte(start)
+	}
+	if end != "" {
+		upper = []byte(end)
+	}
+
+	it, err := db.NewIterator(lower, upper)
+	if err != nil {
+		return nil, err
 	}
+	defer it.Close()
+
+	var entries []Entry
+	for ; it.Valid(); it.Next() {
+		entries = append(entries, Entry{Key: it.Key(), Value: it.Value()})
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return entries, nil
 }
 
-// Close closes the database and flushes any remaining data
+// newIteratorAtSeq is NewIterator restricted to versions with a sequence
+// number no greater than maxSeq, the merged view a Snapshot reads through.
+// Callers must hold at least db.mu's read lock.
+func (db *SSTableDB) newIteratorAtSeq(lower, upper []byte, maxSeq uint64) (Iterator, error) {
+	var sources []Iterator
+	sources = append(sources, db.memtable.Iterator(string(lower), string(upper)))
+
+	for _, level := range db.levels {
+		for _, sst := range level {
+			it, err := sst.NewIterator()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open iterator for SSTable %s: %w", sst.FileDesc(), err)
+			}
+			sources = append(sources, it)
+		}
+	}
+
+	return newBoundedIterator(NewMergingIterator(sources, maxSeq), lower, upper), nil
+}
+
+// Close closes the database and flushes any remaining data. If
+// options.AsyncCompaction is set, it also stops the background compaction
+// goroutine and waits for any compaction it's mid-run on to finish first.
 func (db *SSTableDB) Close() error {
+	if db.options.AsyncCompaction {
+		close(db.compactDone)
+		db.compactWG.Wait()
+	}
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
 	// Flush memtable before closing
 	if !db.memtable.IsEmpty() {
-		return db.flushMemtable()
+		if err := db.flushMemtable(); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	if err := db.storage.Close(); err != nil {
+		return err
+	}
+	return db.lock.Release()
 }
@@ -0,0 +1,219 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/dukky/toydb/storage"
+)
+
+// This file preserves the ability to read version 1 SSTables: the original
+// format, where each entry and each sparse-index entry was a length-
+// prefixed JSON record and the footer was a dynamically-sized JSON blob at
+// the end of the file. WriteSSTable no longer produces this format (see
+// sstable.go for the block-based version 2 writer); OpenSSTable falls back
+// to openLegacySSTable only when a file's last footerSize bytes don't end
+// in the version 2 magic number.
+
+// legacyIndexEntry is a sparse index entry in a version 1 SSTable.
+type legacyIndexEntry struct {
+	Key    string
+	Offset int64
+}
+
+// legacyFooter is the dynamically-sized JSON footer written at the end of a
+// version 1 SSTable.
+type legacyFooter struct {
+	Version     int
+	IndexOffset int64 // Byte offset where the index starts
+	NumEntries  int   // Total number of data entries
+}
+
+func openLegacySSTable(s storage.Storage, fd storage.FileDesc, file storage.Reader, fileSize int64) (*SSTable, error) {
+	if fileSize < 8 {
+		return nil, fmt.Errorf("SSTable file too small")
+	}
+
+	r := io.NewSectionReader(file, 0, fileSize)
+
+	if _, err := r.Seek(fileSize-8, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to footer length: %w", err)
+	}
+
+	var footerLength int64
+	if err := binary.Read(r, binary.LittleEndian, &footerLength); err != nil {
+		return nil, fmt.Errorf("failed to read footer length: %w", err)
+	}
+
+	footerOffset := fileSize - 8 - footerLength
+	if footerOffset < 0 {
+		return nil, fmt.Errorf("invalid footer offset: %d (fileSize=%d, footerLength=%d)", footerOffset, fileSize, footerLength)
+	}
+	if _, err := r.Seek(footerOffset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to footer: %w", err)
+	}
+
+	footerData := make([]byte, footerLength)
+	if _, err := r.Read(footerData); err != nil {
+		return nil, fmt.Errorf("failed to read footer: %w", err)
+	}
+
+	var footer legacyFooter
+	if err := json.Unmarshal(footerData, &footer); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal footer: %w", err)
+	}
+
+	if _, err := r.Seek(footer.IndexOffset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to index: %w", err)
+	}
+
+	var index []legacyIndexEntry
+	currentOffset := footer.IndexOffset
+
+	for currentOffset < footerOffset {
+		var length int64
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return nil, fmt.Errorf("failed to read index entry length: %w", err)
+		}
+		currentOffset += 8
+
+		data := make([]byte, length)
+		if _, err := r.Read(data); err != nil {
+			return nil, fmt.Errorf("failed to read index entry data: %w", err)
+		}
+		currentOffset += length
+
+		var idxEntry legacyIndexEntry
+		if err := json.Unmarshal(data, &idxEntry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal index entry: %w", err)
+		}
+
+		index = append(index, idxEntry)
+	}
+
+	return &SSTable{
+		storage:     s,
+		fd:          fd,
+		legacyIndex: index,
+		footer: SSTableFooter{
+			Version:     footer.Version,
+			IndexHandle: BlockHandle{Offset: footer.IndexOffset},
+		},
+	}, nil
+}
+
+func (sst *SSTable) getLegacy(key string) (string, bool, error) {
+	file, err := sst.storage.Open(sst.fd)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to open SSTable: %w", err)
+	}
+	defer file.Close()
+
+	size, err := file.Size()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to stat SSTable: %w", err)
+	}
+	r := io.NewSectionReader(file, 0, size)
+
+	startOffset := int64(0)
+	endOffset := sst.footer.IndexHandle.Offset
+
+	if len(sst.legacyIndex) > 0 {
+		idx := 0
+		for idx < len(sst.legacyIndex) && sst.legacyIndex[idx].Key < key {
+			idx++
+		}
+
+		if idx < len(sst.legacyIndex) {
+			if sst.legacyIndex[idx].Key == key {
+				startOffset = sst.legacyIndex[idx].Offset
+			} else if idx > 0 {
+				startOffset = sst.legacyIndex[idx-1].Offset
+			}
+			if idx+1 < len(sst.legacyIndex) {
+				endOffset = sst.legacyIndex[idx+1].Offset
+			}
+		} else {
+			startOffset = sst.legacyIndex[len(sst.legacyIndex)-1].Offset
+		}
+	}
+
+	if _, err := r.Seek(startOffset, io.SeekStart); err != nil {
+		return "", false, fmt.Errorf("failed to seek: %w", err)
+	}
+
+	currentOffset := startOffset
+	for currentOffset < endOffset {
+		var length int64
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			break
+		}
+		currentOffset += 8
+
+		data := make([]byte, length)
+		if _, err := r.Read(data); err != nil {
+			return "", false, fmt.Errorf("failed to read entry: %w", err)
+		}
+		currentOffset += length
+
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return "", false, fmt.Errorf("failed to unmarshal entry: %w", err)
+		}
+
+		if entry.Key == key {
+			if entry.Deleted {
+				return "", true, nil
+			}
+			return entry.Value, true, nil
+		}
+
+		if entry.Key > key {
+			return "", false, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+func (sst *SSTable) getAllEntriesLegacy() ([]Entry, error) {
+	file, err := sst.storage.Open(sst.fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSTable: %w", err)
+	}
+	defer file.Close()
+
+	size, err := file.Size()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat SSTable: %w", err)
+	}
+	r := io.NewSectionReader(file, 0, size)
+
+	var entries []Entry
+	var currentOffset int64 = 0
+
+	for currentOffset < sst.footer.IndexHandle.Offset {
+		var length int64
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			break
+		}
+		currentOffset += 8
+
+		data := make([]byte, length)
+		if _, err := r.Read(data); err != nil {
+			return nil, fmt.Errorf("failed to read entry: %w", err)
+		}
+		currentOffset += length
+
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal entry: %w", err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,81 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"github.com/dukky/toydb/storage"
+)
+
+// writeLegacySSTableForTest reproduces the original (version 1) on-disk
+// format byte-for-byte, so tests can verify OpenSSTable still reads files
+// written before the version 2 block format existed.
+func writeLegacySSTableForTest(s storage.Storage, fd storage.FileDesc, entries []Entry) error {
+	file, err := s.Create(fd)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	var index []legacyIndexEntry
+	var offset int64
+
+	for i, entry := range entries {
+		if i%IndexInterval == 0 {
+			index = append(index, legacyIndexEntry{Key: entry.Key, Offset: offset})
+		}
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		length := int64(len(data))
+		if err := binary.Write(file, binary.LittleEndian, length); err != nil {
+			return err
+		}
+		offset += 8
+
+		n, err := file.Write(data)
+		if err != nil {
+			return err
+		}
+		offset += int64(n)
+	}
+
+	indexOffset := offset
+	for _, ie := range index {
+		data, err := json.Marshal(ie)
+		if err != nil {
+			return err
+		}
+		length := int64(len(data))
+		if err := binary.Write(file, binary.LittleEndian, length); err != nil {
+			return err
+		}
+		if _, err := file.Write(data); err != nil {
+			return err
+		}
+	}
+
+	footer := legacyFooter{Version: 1, IndexOffset: indexOffset, NumEntries: len(entries)}
+	footerData, err := json.Marshal(footer)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(footerData); err != nil {
+		return err
+	}
+
+	footerLength := int64(len(footerData))
+	if err := binary.Write(file, binary.LittleEndian, footerLength); err != nil {
+		return err
+	}
+
+	return nil
+}
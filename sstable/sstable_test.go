@@ -1,16 +1,22 @@
 package sstable
 
 import (
+	"fmt"
+	"math"
+	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/dukky/toydb/db"
+	"github.com/dukky/toydb/storage"
 )
 
 func TestMemtable(t *testing.T) {
 	mem := NewMemtable()
 
 	// Test Put and Get
-	mem.Put("key1", "value1")
-	mem.Put("key2", "value2")
+	mem.Put("key1", "value1", 1)
+	mem.Put("key2", "value2", 2)
 
 	val, found := mem.Get("key1")
 	if !found || val != "value1" {
@@ -23,7 +29,7 @@ func TestMemtable(t *testing.T) {
 	}
 
 	// Test overwrite
-	mem.Put("key1", "new_value1")
+	mem.Put("key1", "new_value1", 3)
 	val, found = mem.Get("key1")
 	if !found || val != "new_value1" {
 		t.Errorf("Expected new_value1, got %s", val)
@@ -39,8 +45,8 @@ func TestMemtable(t *testing.T) {
 func TestMemtableDelete(t *testing.T) {
 	mem := NewMemtable()
 
-	mem.Put("key1", "value1")
-	mem.Delete("key1")
+	mem.Put("key1", "value1", 1)
+	mem.Delete("key1", 2)
 
 	_, found := mem.Get("key1")
 	if found {
@@ -52,10 +58,10 @@ func TestMemtableSortedEntries(t *testing.T) {
 	mem := NewMemtable()
 
 	// Insert in random order
-	mem.Put("zebra", "z")
-	mem.Put("apple", "a")
-	mem.Put("mango", "m")
-	mem.Put("banana", "b")
+	mem.Put("zebra", "z", 1)
+	mem.Put("apple", "a", 2)
+	mem.Put("mango", "m", 3)
+	mem.Put("banana", "b", 4)
 
 	entries := mem.GetSortedEntries()
 
@@ -72,9 +78,64 @@ func TestMemtableSortedEntries(t *testing.T) {
 	}
 }
 
+func TestMemtableIteratorRange(t *testing.T) {
+	mem := NewMemtable()
+
+	mem.Put("zebra", "z", 1)
+	mem.Put("apple", "a", 2)
+	mem.Put("mango", "m", 3)
+	mem.Put("banana", "b", 4)
+	mem.Put("cherry", "c", 5)
+
+	it := mem.Iterator("banana", "mango")
+	defer it.Close()
+
+	var keys []string
+	for it.Next(); it.Valid(); it.Next() {
+		keys = append(keys, it.Key())
+	}
+
+	expected := []string{"banana", "cherry"}
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected keys %v, got %v", expected, keys)
+	}
+	for i, k := range expected {
+		if keys[i] != k {
+			t.Errorf("Expected key %s at position %d, got %s", k, i, keys[i])
+		}
+	}
+}
+
+func TestMemtableIteratorUnboundedMatchesSortedEntries(t *testing.T) {
+	mem := NewMemtable()
+
+	// Enough keys to promote several nodes past level 0.
+	for i := 0; i < 200; i++ {
+		mem.Put(fmt.Sprintf("key-%03d", i), fmt.Sprintf("value-%03d", i), uint64(i+1))
+	}
+
+	it := mem.Iterator("", "")
+	defer it.Close()
+
+	var fromIterator []Entry
+	for it.Next(); it.Valid(); it.Next() {
+		fromIterator = append(fromIterator, Entry{Key: it.Key(), Value: it.Value()})
+	}
+
+	sorted := mem.GetSortedEntries()
+	if len(fromIterator) != len(sorted) {
+		t.Fatalf("Expected %d entries from Iterator, got %d", len(sorted), len(fromIterator))
+	}
+	for i, e := range sorted {
+		if fromIterator[i].Key != e.Key || fromIterator[i].Value != e.Value {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, e, fromIterator[i])
+		}
+	}
+}
+
 func TestSSTableWriteAndRead(t *testing.T) {
-	tempDir := t.TempDir()
-	sstablePath := filepath.Join(tempDir, "test.sst")
+	s := storage.NewMemStorage()
+	fd := storage.FileDesc{Type: storage.TypeSSTable, Num: 1}
 
 	// Create test entries
 	entries := []Entry{
@@ -85,12 +146,12 @@ func TestSSTableWriteAndRead(t *testing.T) {
 	}
 
 	// Write SSTable
-	if err := WriteSSTable(sstablePath, entries); err != nil {
+	if err := WriteSSTable(s, fd, entries); err != nil {
 		t.Fatalf("Failed to write SSTable: %v", err)
 	}
 
 	// Open SSTable
-	sst, err := OpenSSTable(sstablePath)
+	sst, err := OpenSSTable(s, fd)
 	if err != nil {
 		t.Fatalf("Failed to open SSTable: %v", err)
 	}
@@ -122,9 +183,47 @@ func TestSSTableWriteAndRead(t *testing.T) {
 	}
 }
 
+func TestSSTableFilterRejections(t *testing.T) {
+	s := storage.NewMemStorage()
+	fd := storage.FileDesc{Type: storage.TypeSSTable, Num: 1}
+
+	entries := []Entry{
+		{Key: "apple", Value: "red"},
+		{Key: "banana", Value: "yellow"},
+		{Key: "cherry", Value: "red"},
+	}
+	if err := WriteSSTable(s, fd, entries); err != nil {
+		t.Fatalf("Failed to write SSTable: %v", err)
+	}
+
+	sst, err := OpenSSTable(s, fd)
+	if err != nil {
+		t.Fatalf("Failed to open SSTable: %v", err)
+	}
+
+	if n := sst.FilterRejections(); n != 0 {
+		t.Fatalf("expected 0 filter rejections before any lookups, got %d", n)
+	}
+
+	if _, found, err := sst.Get("missing"); err != nil || found {
+		t.Fatalf("Get(missing) = found=%v, err=%v", found, err)
+	}
+	if n := sst.FilterRejections(); n != 1 {
+		t.Errorf("expected 1 filter rejection after a missing-key lookup, got %d", n)
+	}
+
+	// A present key must not count as a rejection.
+	if _, found, err := sst.Get("apple"); err != nil || !found {
+		t.Fatalf("Get(apple) = found=%v, err=%v", found, err)
+	}
+	if n := sst.FilterRejections(); n != 1 {
+		t.Errorf("expected filter rejection count to stay at 1, got %d", n)
+	}
+}
+
 func TestSSTableWithTombstones(t *testing.T) {
-	tempDir := t.TempDir()
-	sstablePath := filepath.Join(tempDir, "test.sst")
+	s := storage.NewMemStorage()
+	fd := storage.FileDesc{Type: storage.TypeSSTable, Num: 1}
 
 	// Create test entries with tombstone
 	entries := []Entry{
@@ -134,12 +233,12 @@ func TestSSTableWithTombstones(t *testing.T) {
 	}
 
 	// Write SSTable
-	if err := WriteSSTable(sstablePath, entries); err != nil {
+	if err := WriteSSTable(s, fd, entries); err != nil {
 		t.Fatalf("Failed to write SSTable: %v", err)
 	}
 
 	// Open SSTable
-	sst, err := OpenSSTable(sstablePath)
+	sst, err := OpenSSTable(s, fd)
 	if err != nil {
 		t.Fatalf("Failed to open SSTable: %v", err)
 	}
@@ -167,9 +266,7 @@ func TestSSTableWithTombstones(t *testing.T) {
 }
 
 func TestSSTableDB(t *testing.T) {
-	tempDir := t.TempDir()
-
-	db, err := NewSSTableDB(tempDir)
+	db, err := NewSSTableDB(storage.NewMemStorage())
 	if err != nil {
 		t.Fatalf("Failed to create SSTableDB: %v", err)
 	}
@@ -213,9 +310,9 @@ func TestSSTableDB(t *testing.T) {
 }
 
 func TestSSTableDBFlush(t *testing.T) {
-	tempDir := t.TempDir()
+	s := storage.NewMemStorage()
 
-	db, err := NewSSTableDB(tempDir)
+	db, err := NewSSTableDB(s)
 	if err != nil {
 		t.Fatalf("Failed to create SSTableDB: %v", err)
 	}
@@ -233,7 +330,7 @@ func TestSSTableDBFlush(t *testing.T) {
 	// Close and reopen
 	db.Close()
 
-	db2, err := NewSSTableDB(tempDir)
+	db2, err := NewSSTableDB(s)
 	if err != nil {
 		t.Fatalf("Failed to reopen SSTableDB: %v", err)
 	}
@@ -250,9 +347,7 @@ func TestSSTableDBFlush(t *testing.T) {
 }
 
 func TestSSTableDBCompaction(t *testing.T) {
-	tempDir := t.TempDir()
-
-	db, err := NewSSTableDB(tempDir)
+	db, err := NewSSTableDB(storage.NewMemStorage())
 	if err != nil {
 		t.Fatalf("Failed to create SSTableDB: %v", err)
 	}
@@ -281,6 +376,10 @@ func TestSSTableDBCompaction(t *testing.T) {
 		t.Errorf("Expected 1 SSTable after compaction, got %d", numSSTables)
 	}
 
+	if compactions := stats["compactions_run"].(int64); compactions == 0 {
+		t.Error("Expected compactions_run to be nonzero after Compact")
+	}
+
 	// Verify data is still accessible
 	val, err := db.Read("key1")
 	if err != nil {
@@ -292,9 +391,7 @@ func TestSSTableDBCompaction(t *testing.T) {
 }
 
 func TestSSTableDBCompactionWithDeletes(t *testing.T) {
-	tempDir := t.TempDir()
-
-	db, err := NewSSTableDB(tempDir)
+	db, err := NewSSTableDB(storage.NewMemStorage())
 	if err != nil {
 		t.Fatalf("Failed to create SSTableDB: %v", err)
 	}
@@ -328,9 +425,7 @@ func TestSSTableDBCompactionWithDeletes(t *testing.T) {
 }
 
 func TestSSTableDBLargeDataset(t *testing.T) {
-	tempDir := t.TempDir()
-
-	db, err := NewSSTableDB(tempDir)
+	db, err := NewSSTableDB(storage.NewMemStorage())
 	if err != nil {
 		t.Fatalf("Failed to create SSTableDB: %v", err)
 	}
@@ -360,11 +455,289 @@ func TestSSTableDBLargeDataset(t *testing.T) {
 	}
 }
 
-func TestSSTableDBPersistence(t *testing.T) {
+func TestSSTableSpansMultipleBlocks(t *testing.T) {
+	s := storage.NewMemStorage()
+	fd := storage.FileDesc{Type: storage.TypeSSTable, Num: 1}
+
+	// Write enough data to force several ~4 KiB blocks.
+	var entries []Entry
+	for i := 0; i < 2000; i++ {
+		entries = append(entries, Entry{Key: fmt.Sprintf("key%04d", i), Value: fmt.Sprintf("value%04d", i)})
+	}
+
+	if err := WriteSSTable(s, fd, entries); err != nil {
+		t.Fatalf("Failed to write SSTable: %v", err)
+	}
+
+	sst, err := OpenSSTable(s, fd)
+	if err != nil {
+		t.Fatalf("Failed to open SSTable: %v", err)
+	}
+
+	if len(sst.index) < 2 {
+		t.Fatalf("Expected the dataset to span multiple blocks, got %d", len(sst.index))
+	}
+
+	for i := 0; i < 2000; i += 137 {
+		key := fmt.Sprintf("key%04d", i)
+		val, found, err := sst.Get(key)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", key, err)
+		}
+		if !found || val != fmt.Sprintf("value%04d", i) {
+			t.Errorf("Expected value%04d for %s, got found=%v val=%s", i, key, found, val)
+		}
+	}
+
+	all, err := sst.GetAllEntries()
+	if err != nil {
+		t.Fatalf("Failed to get all entries: %v", err)
+	}
+	if len(all) != len(entries) {
+		t.Errorf("Expected %d entries, got %d", len(entries), len(all))
+	}
+}
+
+func TestLookupBlockMatchesDecodeBlock(t *testing.T) {
+	var entries []Entry
+	for i := 0; i < 5*IndexInterval+3; i++ {
+		entries = append(entries, Entry{Key: fmt.Sprintf("key%04d", i), Value: fmt.Sprintf("value%04d", i), Seq: uint64(i + 1)})
+	}
+	raw := encodeBlock(entries)
+
+	decoded, err := decodeBlock(raw)
+	if err != nil {
+		t.Fatalf("Failed to decode block: %v", err)
+	}
+	if len(decoded) != len(entries) {
+		t.Fatalf("Expected %d entries, got %d", len(entries), len(decoded))
+	}
+
+	// Every present key, including ones that fall exactly on a restart
+	// point and ones in between, should resolve to the same entry
+	// decodeBlock finds.
+	for _, want := range decoded {
+		got, found, err := lookupBlock(raw, want.Key, math.MaxUint64)
+		if err != nil {
+			t.Fatalf("lookupBlock(%s) error: %v", want.Key, err)
+		}
+		if !found || got != want {
+			t.Errorf("lookupBlock(%s) = %+v, found=%v; want %+v", want.Key, got, found, want)
+		}
+	}
+
+	// A key before the block's first key, one between two present keys,
+	// and one after the block's last key should all miss.
+	for _, missing := range []string{"aaa-before", "key0001-between", "zzz-after"} {
+		if _, found, err := lookupBlock(raw, missing, math.MaxUint64); err != nil {
+			t.Fatalf("lookupBlock(%s) error: %v", missing, err)
+		} else if found {
+			t.Errorf("Expected %s not to be found", missing)
+		}
+	}
+
+	// A maxSeq older than every entry's Seq should hide a key that
+	// otherwise exists in the block.
+	if _, found, err := lookupBlock(raw, decoded[0].Key, 0); err != nil {
+		t.Fatalf("lookupBlock with maxSeq=0 error: %v", err)
+	} else if found {
+		t.Error("Expected maxSeq=0 to hide every entry")
+	}
+}
+
+func TestSSTableDetectsCorruption(t *testing.T) {
 	tempDir := t.TempDir()
+	s, err := storage.NewFileStorage(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create FileStorage: %v", err)
+	}
+	fd := storage.FileDesc{Type: storage.TypeSSTable, Num: 1}
+
+	entries := []Entry{
+		{Key: "apple", Value: "red"},
+		{Key: "banana", Value: "yellow"},
+	}
+	if err := WriteSSTable(s, fd, entries); err != nil {
+		t.Fatalf("Failed to write SSTable: %v", err)
+	}
+
+	// Flip a byte near the start of the file, inside the first data block.
+	sstablePath := filepath.Join(tempDir, "sstable_000001.sst")
+	raw, err := os.ReadFile(sstablePath)
+	if err != nil {
+		t.Fatalf("Failed to read SSTable file: %v", err)
+	}
+	raw[2] ^= 0xFF
+	if err := os.WriteFile(sstablePath, raw, 0644); err != nil {
+		t.Fatalf("Failed to rewrite SSTable file: %v", err)
+	}
+
+	sst, err := OpenSSTable(s, fd)
+	if err != nil {
+		t.Fatalf("Failed to open SSTable: %v", err)
+	}
+
+	if _, _, err := sst.Get("apple"); err == nil {
+		t.Error("Expected a checksum error reading from a corrupted block")
+	} else if _, ok := err.(*ErrCorrupted); !ok {
+		t.Errorf("Expected *ErrCorrupted, got %T: %v", err, err)
+	}
+}
+
+func TestOpenLegacyV1SSTable(t *testing.T) {
+	s := storage.NewMemStorage()
+	fd := storage.FileDesc{Type: storage.TypeSSTable, Num: 1}
+
+	if err := writeLegacySSTableForTest(s, fd, []Entry{
+		{Key: "apple", Value: "red"},
+		{Key: "banana", Value: "yellow", Deleted: true},
+		{Key: "cherry", Value: "red"},
+	}); err != nil {
+		t.Fatalf("Failed to write legacy SSTable: %v", err)
+	}
+
+	sst, err := OpenSSTable(s, fd)
+	if err != nil {
+		t.Fatalf("Failed to open legacy SSTable: %v", err)
+	}
+	if sst.footer.Version != 1 {
+		t.Fatalf("Expected version 1, got %d", sst.footer.Version)
+	}
+
+	val, found, err := sst.Get("apple")
+	if err != nil || !found || val != "red" {
+		t.Errorf("Expected red, got %s (found=%v, err=%v)", val, found, err)
+	}
+
+	_, found, err = sst.Get("banana")
+	if err != nil || !found {
+		t.Errorf("Expected tombstone to be found, got found=%v err=%v", found, err)
+	}
+
+	all, err := sst.GetAllEntries()
+	if err != nil {
+		t.Fatalf("Failed to get all entries: %v", err)
+	}
+	if len(all) != 3 {
+		t.Errorf("Expected 3 entries, got %d", len(all))
+	}
+}
+
+func TestSSTableDBWriteBatch(t *testing.T) {
+	sdb, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer sdb.Close()
+
+	if err := sdb.Write("existing", "before"); err != nil {
+		t.Fatalf("Failed to seed key: %v", err)
+	}
+
+	var batch db.Batch
+	batch.Put("key1", "value1")
+	batch.Put("key2", "value2")
+	batch.Delete("existing")
+
+	if err := sdb.WriteBatch(&batch); err != nil {
+		t.Fatalf("Failed to write batch: %v", err)
+	}
+
+	val, err := sdb.Read("key1")
+	if err != nil || val != "value1" {
+		t.Errorf("Expected value1, got %s (err=%v)", val, err)
+	}
+
+	val, err = sdb.Read("key2")
+	if err != nil || val != "value2" {
+		t.Errorf("Expected value2, got %s (err=%v)", val, err)
+	}
+
+	if _, err := sdb.Read("existing"); err == nil {
+		t.Error("Expected error reading key deleted via batch")
+	}
+}
+
+func TestSSTableDBApplyBatch(t *testing.T) {
+	sdb, err := NewSSTableDB(storage.NewMemStorage())
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer sdb.Close()
+
+	if err := sdb.Write("existing", "before"); err != nil {
+		t.Fatalf("Failed to seed key: %v", err)
+	}
+
+	var batch Batch
+	batch.Put("key1", "value1")
+	batch.Put("key2", "value2")
+	batch.Delete("existing")
+	if batch.Count() != 3 {
+		t.Fatalf("Expected Count 3, got %d", batch.Count())
+	}
+
+	if err := sdb.ApplyBatch(&batch); err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+
+	val, err := sdb.Read("key1")
+	if err != nil || val != "value1" {
+		t.Errorf("Expected value1, got %s (err=%v)", val, err)
+	}
+
+	val, err = sdb.Read("key2")
+	if err != nil || val != "value2" {
+		t.Errorf("Expected value2, got %s (err=%v)", val, err)
+	}
+
+	if _, err := sdb.Read("existing"); err == nil {
+		t.Error("Expected error reading key deleted via batch")
+	}
+}
+
+func TestBatchReplay(t *testing.T) {
+	var batch Batch
+	batch.Put("a", "1")
+	batch.Delete("b")
+	batch.Put("c", "3")
+
+	var got []string
+	replay := replayFunc{
+		put:    func(k, v string) error { got = append(got, "put:"+k+"="+v); return nil },
+		delete: func(k string) error { got = append(got, "delete:"+k); return nil },
+	}
+	if err := batch.Replay(replay); err != nil {
+		t.Fatalf("Failed to replay batch: %v", err)
+	}
+
+	want := []string{"put:a=1", "delete:b", "put:c=3"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, got)
+			break
+		}
+	}
+}
+
+// replayFunc is a BatchReplay built from plain funcs, for testing Replay
+// without reaching into a memtable or SSTableDB.
+type replayFunc struct {
+	put    func(key, value string) error
+	delete func(key string) error
+}
+
+func (r replayFunc) Put(key, value string) error { return r.put(key, value) }
+func (r replayFunc) Delete(key string) error     { return r.delete(key) }
+
+func TestSSTableDBPersistence(t *testing.T) {
+	s := storage.NewMemStorage()
 
 	// Create DB and write data
-	db, err := NewSSTableDB(tempDir)
+	db, err := NewSSTableDB(s)
 	if err != nil {
 		t.Fatalf("Failed to create SSTableDB: %v", err)
 	}
@@ -380,7 +753,7 @@ func TestSSTableDBPersistence(t *testing.T) {
 	db.Close()
 
 	// Reopen and verify data
-	db2, err := NewSSTableDB(tempDir)
+	db2, err := NewSSTableDB(s)
 	if err != nil {
 		t.Fatalf("Failed to reopen SSTableDB: %v", err)
 	}
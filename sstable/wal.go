@@ -0,0 +1,204 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/dukky/toydb/storage"
+)
+
+// walRecordHeaderSize is the fixed prefix every WAL record starts with: a
+// 4-byte payload length followed by a 4-byte CRC32C of the payload. The
+// header precedes the payload so a reader can tell a record is truncated or
+// corrupt before trying to decode it.
+const walRecordHeaderSize = 8
+
+// walRecord is one logged write, replayed in order to rebuild a memtable
+// after a crash. It mirrors what Memtable.Put/Delete records.
+type walRecord struct {
+	Seq     uint64
+	Key     string
+	Value   string
+	Deleted bool
+}
+
+// wal is a per-memtable write-ahead log: every Write/Delete/WriteBatch is
+// appended here before it touches the memtable, so a crash before the next
+// flush can still recover it. It appends through storage.Storage.Append,
+// so an already-fsynced record is never at risk from a later write.
+type wal struct {
+	storage storage.Storage
+	fd      storage.FileDesc
+	sync    bool // fsync every append before it returns; see Options.WALSync
+}
+
+func newWAL(s storage.Storage, fd storage.FileDesc, sync bool) *wal {
+	return &wal{storage: s, fd: fd, sync: sync}
+}
+
+// append is appendBatch for a single record.
+func (w *wal) append(r walRecord) error {
+	return w.appendBatch([]walRecord{r})
+}
+
+// appendBatch appends every record in records as one contiguous write, so a
+// crash either sees all of them or none of them - the same guarantee
+// WriteBatch gives the memtable.
+func (w *wal) appendBatch(records []walRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	file, err := w.storage.Append(w.fd)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL %s: %w", w.fd, err)
+	}
+	defer file.Close()
+
+	var buf []byte
+	for _, r := range records {
+		buf = append(buf, encodeWALRecord(r)...)
+	}
+	if _, err := file.Write(buf); err != nil {
+		return fmt.Errorf("failed to append to WAL %s: %w", w.fd, err)
+	}
+
+	if w.sync {
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync WAL %s: %w", w.fd, err)
+		}
+	}
+	return nil
+}
+
+// readRaw returns the WAL's current raw contents, or nil if it doesn't
+// exist yet.
+func (w *wal) readRaw() ([]byte, error) {
+	reader, err := w.storage.Open(w.fd)
+	if err != nil {
+		return nil, nil
+	}
+	defer reader.Close()
+
+	size, err := reader.Size()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat WAL %s: %w", w.fd, err)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(reader, 0, size), buf); err != nil {
+		return nil, fmt.Errorf("failed to read WAL %s: %w", w.fd, err)
+	}
+	return buf, nil
+}
+
+// encodeWALRecord serializes r as a walRecordHeaderSize header (payload
+// length, then CRC32C of the payload) followed by the payload: a varint
+// Seq, a length-prefixed Key, a length-prefixed Value, and a 1-byte deleted
+// flag - the same varint framing encodeBlock uses for SSTable entries.
+func encodeWALRecord(r walRecord) []byte {
+	var buf bytes.Buffer
+	var varintBuf [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(varintBuf[:], r.Seq)
+	buf.Write(varintBuf[:n])
+	n = binary.PutUvarint(varintBuf[:], uint64(len(r.Key)))
+	buf.Write(varintBuf[:n])
+	buf.WriteString(r.Key)
+	n = binary.PutUvarint(varintBuf[:], uint64(len(r.Value)))
+	buf.Write(varintBuf[:n])
+	buf.WriteString(r.Value)
+	if r.Deleted {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+
+	payload := buf.Bytes()
+	record := make([]byte, walRecordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[walRecordHeaderSize:], payload)
+	return record
+}
+
+// decodeWALPayload is the inverse of the payload encodeWALRecord writes
+// after its header.
+func decodeWALPayload(payload []byte) (walRecord, error) {
+	seq, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return walRecord{}, fmt.Errorf("invalid seq varint")
+	}
+	payload = payload[n:]
+
+	keyLen, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return walRecord{}, fmt.Errorf("invalid key-length varint")
+	}
+	payload = payload[n:]
+	if keyLen > uint64(len(payload)) {
+		return walRecord{}, fmt.Errorf("key length %d exceeds remaining %d bytes", keyLen, len(payload))
+	}
+	key := string(payload[:keyLen])
+	payload = payload[keyLen:]
+
+	valLen, n := binary.Uvarint(payload)
+	if n <= 0 {
+		return walRecord{}, fmt.Errorf("invalid value-length varint")
+	}
+	payload = payload[n:]
+	if valLen > uint64(len(payload)) {
+		return walRecord{}, fmt.Errorf("value length %d exceeds remaining %d bytes", valLen, len(payload))
+	}
+	value := string(payload[:valLen])
+	payload = payload[valLen:]
+
+	if len(payload) < 1 {
+		return walRecord{}, fmt.Errorf("missing deleted flag byte")
+	}
+	deleted := payload[0] == 1
+
+	return walRecord{Seq: seq, Key: key, Value: value, Deleted: deleted}, nil
+}
+
+// replayWAL reads every well-formed record in fd's WAL file, in the order
+// they were appended. It stops at the first record whose header or CRC
+// doesn't check out rather than returning an error: a crash can leave the
+// last record half-written, and everything before it is still trustworthy,
+// matching goleveldb's log recovery behavior. found is false if fd doesn't
+// exist.
+func replayWAL(s storage.Storage, fd storage.FileDesc) (records []walRecord, found bool, err error) {
+	w := newWAL(s, fd, false)
+	buf, err := w.readRaw()
+	if err != nil {
+		return nil, false, err
+	}
+	if buf == nil {
+		return nil, false, nil
+	}
+
+	for len(buf) >= walRecordHeaderSize {
+		length := binary.LittleEndian.Uint32(buf[0:4])
+		crc := binary.LittleEndian.Uint32(buf[4:8])
+		rest := buf[walRecordHeaderSize:]
+
+		if uint64(length) > uint64(len(rest)) {
+			break // truncated trailing record: a crash mid-write.
+		}
+		payload := rest[:length]
+		if crc32.Checksum(payload, crcTable) != crc {
+			break // corrupt trailing record: discard it and whatever follows.
+		}
+
+		record, err := decodeWALPayload(payload)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decode WAL %s: %w", fd, err)
+		}
+		records = append(records, record)
+		buf = rest[length:]
+	}
+
+	return records, true, nil
+}
@@ -0,0 +1,178 @@
+package sstable
+
+import (
+	"testing"
+
+	"github.com/dukky/toydb/storage"
+)
+
+func TestWALRecoversUnflushedWrites(t *testing.T) {
+	s := storage.NewMemStorage()
+
+	db, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Write("key2", "value2"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Delete("key1"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	// No Flush and no graceful Close: simulates a crash before the memtable
+	// ever made it to disk. Release the storage lock directly rather than
+	// through Close, which would flush the memtable and defeat the point
+	// of the test - a real process crash frees the lock the same way,
+	// without giving the memtable a chance to flush.
+	db.lock.Release()
+
+	recovered, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to recover SSTableDB: %v", err)
+	}
+	defer recovered.Close()
+
+	if _, err := recovered.Read("key1"); err == nil {
+		t.Error("Expected key1 to still read as deleted after recovery")
+	}
+
+	val, err := recovered.Read("key2")
+	if err != nil {
+		t.Fatalf("Failed to read recovered key2: %v", err)
+	}
+	if val != "value2" {
+		t.Errorf("Expected value2, got %s", val)
+	}
+}
+
+func TestWALDiscardsTruncatedTrailingRecord(t *testing.T) {
+	s := storage.NewMemStorage()
+	fd := storage.FileDesc{Type: storage.TypeLog, Num: 0}
+
+	good := encodeWALRecord(walRecord{Seq: 1, Key: "key1", Value: "value1"})
+	truncated := encodeWALRecord(walRecord{Seq: 2, Key: "key2", Value: "value2"})
+	truncated = truncated[:len(truncated)-3] // cut off mid-payload, as a crash mid-append would.
+
+	file, err := s.Create(fd)
+	if err != nil {
+		t.Fatalf("Failed to create WAL file: %v", err)
+	}
+	if _, err := file.Write(append(good, truncated...)); err != nil {
+		t.Fatalf("Failed to write WAL file: %v", err)
+	}
+	file.Close()
+
+	db, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to open SSTableDB with a truncated WAL: %v", err)
+	}
+	defer db.Close()
+
+	val, err := db.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read recovered key1: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+
+	if _, err := db.Read("key2"); err == nil {
+		t.Error("Expected the truncated record's key to be dropped, not recovered")
+	}
+}
+
+func TestWALDiscardsCorruptChecksum(t *testing.T) {
+	s := storage.NewMemStorage()
+	fd := storage.FileDesc{Type: storage.TypeLog, Num: 0}
+
+	good := encodeWALRecord(walRecord{Seq: 1, Key: "key1", Value: "value1"})
+	corrupt := encodeWALRecord(walRecord{Seq: 2, Key: "key2", Value: "value2"})
+	corrupt[len(corrupt)-1] ^= 0xFF // flip a payload byte without updating its CRC.
+
+	file, err := s.Create(fd)
+	if err != nil {
+		t.Fatalf("Failed to create WAL file: %v", err)
+	}
+	if _, err := file.Write(append(good, corrupt...)); err != nil {
+		t.Fatalf("Failed to write WAL file: %v", err)
+	}
+	file.Close()
+
+	db, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to open SSTableDB with a corrupt WAL record: %v", err)
+	}
+	defer db.Close()
+
+	val, err := db.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read recovered key1: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+
+	if _, err := db.Read("key2"); err == nil {
+		t.Error("Expected the corrupt record's key to be dropped, not recovered")
+	}
+}
+
+func TestWALSyncRecoversUnflushedWrites(t *testing.T) {
+	s := storage.NewMemStorage()
+
+	db, err := NewSSTableDBWithOptions(s, Options{WALSync: true})
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	// No Flush and no graceful Close: simulates a crash before the memtable
+	// ever made it to disk. Release the storage lock directly rather than
+	// through Close, which would flush the memtable and defeat the point
+	// of the test - a real process crash frees the lock the same way,
+	// without giving the memtable a chance to flush.
+	db.lock.Release()
+
+	recovered, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to recover SSTableDB: %v", err)
+	}
+	defer recovered.Close()
+
+	val, err := recovered.Read("key1")
+	if err != nil {
+		t.Fatalf("Failed to read recovered key1: %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("Expected value1, got %s", val)
+	}
+}
+
+func TestWALRemovedAfterFlush(t *testing.T) {
+	s := storage.NewMemStorage()
+
+	db, err := NewSSTableDB(s)
+	if err != nil {
+		t.Fatalf("Failed to create SSTableDB: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Write("key1", "value1"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	fds, err := s.List(storage.TypeLog)
+	if err != nil {
+		t.Fatalf("Failed to list WAL files: %v", err)
+	}
+	if len(fds) != 0 {
+		t.Errorf("Expected no WAL files after a flush, found %d", len(fds))
+	}
+}
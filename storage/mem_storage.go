@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// memStorage is an in-memory Storage, for tests and callers that want a
+// database without touching a disk.
+type memStorage struct {
+	mu      sync.Mutex
+	files   map[FileDesc]*memFile
+	locked  bool
+	meta    FileDesc
+	hasMeta bool
+}
+
+// memFile is the backing store for one FileDesc: a byte slice any number
+// of readers can see a stable snapshot of, guarded by its own lock so
+// concurrent writers don't race on the slice itself.
+type memFile struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// NewMemStorage returns a Storage that keeps every file in memory.
+func NewMemStorage() Storage {
+	return &memStorage{files: make(map[FileDesc]*memFile)}
+}
+
+type memLock struct {
+	storage *memStorage
+}
+
+func (l *memLock) Release() error {
+	l.storage.mu.Lock()
+	defer l.storage.mu.Unlock()
+	l.storage.locked = false
+	return nil
+}
+
+func (m *memStorage) Lock() (Releaser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked {
+		return nil, fmt.Errorf("storage: already locked")
+	}
+	m.locked = true
+	return &memLock{storage: m}, nil
+}
+
+func (m *memStorage) List(ft FileType) ([]FileDesc, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var fds []FileDesc
+	for fd := range m.files {
+		if fd.Type == ft {
+			fds = append(fds, fd)
+		}
+	}
+	sort.Slice(fds, func(i, j int) bool { return fds[i].Num < fds[j].Num })
+	return fds, nil
+}
+
+func (m *memStorage) Create(fd FileDesc) (Writer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := &memFile{}
+	m.files[fd] = f
+	return &memWriter{file: f}, nil
+}
+
+func (m *memStorage) Append(fd FileDesc) (Writer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, ok := m.files[fd]
+	if !ok {
+		f = &memFile{}
+		m.files[fd] = f
+	}
+	return &memWriter{file: f}, nil
+}
+
+type memWriter struct {
+	file *memFile
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	w.file.mu.Lock()
+	defer w.file.mu.Unlock()
+	w.file.data = append(w.file.data, p...)
+	return len(p), nil
+}
+
+func (w *memWriter) Close() error { return nil }
+
+// Sync is a no-op: a memStorage file has no backing store to flush to.
+func (w *memWriter) Sync() error { return nil }
+
+func (m *memStorage) Open(fd FileDesc) (Reader, error) {
+	m.mu.Lock()
+	f, ok := m.files[fd]
+	m.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("failed to open %s: %w", fd, fmt.Errorf("does not exist"))
+	}
+	return &memReader{file: f}, nil
+}
+
+type memReader struct {
+	file *memFile
+}
+
+func (r *memReader) ReadAt(p []byte, off int64) (int, error) {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+	if off < 0 || off >= int64(len(r.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.file.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *memReader) Size() (int64, error) {
+	r.file.mu.Lock()
+	defer r.file.mu.Unlock()
+	return int64(len(r.file.data)), nil
+}
+
+func (r *memReader) Close() error { return nil }
+
+func (m *memStorage) Remove(fd FileDesc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, fd)
+	return nil
+}
+
+func (m *memStorage) Rename(oldfd, newfd FileDesc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[oldfd]
+	if !ok {
+		return fmt.Errorf("failed to rename %s: does not exist", oldfd)
+	}
+	delete(m.files, oldfd)
+	m.files[newfd] = f
+	return nil
+}
+
+func (m *memStorage) SetMeta(fd FileDesc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.meta, m.hasMeta = fd, true
+	return nil
+}
+
+func (m *memStorage) GetMeta() (FileDesc, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.hasMeta {
+		return FileDesc{}, ErrNoMeta
+	}
+	return m.meta, nil
+}
+
+func (m *memStorage) Close() error { return nil }
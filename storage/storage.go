@@ -0,0 +1,115 @@
+// Package storage abstracts the files a database backend reads and
+// writes, so logdb and sstable don't have to know whether their data
+// lives on the local filesystem, in memory, or somewhere else entirely.
+// It is modeled on goleveldb's storage.Storage: callers name files with a
+// FileDesc instead of a path, and Storage owns the mapping from a
+// FileDesc to wherever it's actually kept.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FileType identifies what kind of file a FileDesc refers to.
+type FileType int
+
+const (
+	TypeSSTable FileType = iota
+	TypeLog
+	TypeManifest
+)
+
+func (t FileType) String() string {
+	switch t {
+	case TypeSSTable:
+		return "sstable"
+	case TypeLog:
+		return "log"
+	case TypeManifest:
+		return "manifest"
+	default:
+		return "unknown"
+	}
+}
+
+// FileDesc identifies one file a Storage manages. Num disambiguates files
+// of the same Type; callers that only ever keep one file of a type (e.g.
+// logdb's single log) just use Num 0.
+type FileDesc struct {
+	Type FileType
+	Num  int
+}
+
+func (fd FileDesc) String() string {
+	return fmt.Sprintf("%s_%06d", fd.Type, fd.Num)
+}
+
+// Reader reads the contents of a file opened with Storage.Open.
+type Reader interface {
+	io.ReaderAt
+	io.Closer
+	Size() (int64, error)
+}
+
+// Writer writes the contents of a file created with Storage.Create.
+type Writer interface {
+	io.Writer
+	io.Closer
+
+	// Sync flushes the file's content to stable storage, for callers that
+	// need a write durable before they acknowledge it. A no-op is a valid
+	// implementation for backends with nothing to flush, e.g. memStorage.
+	Sync() error
+}
+
+// Releaser releases a resource acquired from Storage, such as a lock.
+type Releaser interface {
+	Release() error
+}
+
+// ErrNoMeta is returned by GetMeta when SetMeta has never been called.
+var ErrNoMeta = errors.New("storage: no meta file descriptor set")
+
+// Storage abstracts the files one database instance reads and writes.
+type Storage interface {
+	// Lock acquires exclusive access to the storage, for single-writer
+	// safety. The caller must Release it when done.
+	Lock() (Releaser, error)
+
+	// List returns every FileDesc of type ft currently stored.
+	List(ft FileType) ([]FileDesc, error)
+
+	// Open opens fd for reading.
+	Open(fd FileDesc) (Reader, error)
+
+	// Create creates (or truncates) fd for writing.
+	Create(fd FileDesc) (Writer, error)
+
+	// Append opens fd for appending, creating it if it doesn't exist.
+	// Unlike Create, any existing contents are preserved and writes land
+	// after them: this is the primitive callers that grow a file one
+	// record at a time (wal, manifest, logdb.Log) must use instead of
+	// reading the whole file and Create-ing it again, since a crash
+	// between that read and the rewrite completing would otherwise wipe
+	// out everything already durable, not just the newest record.
+	Append(fd FileDesc) (Writer, error)
+
+	// Remove deletes fd. It is not an error if fd doesn't exist.
+	Remove(fd FileDesc) error
+
+	// Rename renames oldfd to newfd, overwriting newfd if it exists.
+	Rename(oldfd, newfd FileDesc) error
+
+	// SetMeta records fd as the storage's current manifest pointer, so a
+	// reopen can find it without scanning for one.
+	SetMeta(fd FileDesc) error
+
+	// GetMeta returns the FileDesc last recorded by SetMeta, or
+	// ErrNoMeta if none has been set.
+	GetMeta() (FileDesc, error)
+
+	// Close releases any resources the storage itself holds open.
+	Close() error
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"io"
+	"testing"
+)
+
+func testStorage(t *testing.T, newStorage func() Storage) {
+	t.Run("CreateWriteOpenRead", func(t *testing.T) {
+		s := newStorage()
+		fd := FileDesc{Type: TypeSSTable, Num: 1}
+
+		w, err := s.Create(fd)
+		if err != nil {
+			t.Fatalf("Failed to create: %v", err)
+		}
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Failed to close writer: %v", err)
+		}
+
+		r, err := s.Open(fd)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer r.Close()
+
+		size, err := r.Size()
+		if err != nil {
+			t.Fatalf("Failed to get size: %v", err)
+		}
+		if size != 5 {
+			t.Errorf("Expected size 5, got %d", size)
+		}
+
+		buf := make([]byte, 5)
+		if _, err := r.ReadAt(buf, 0); err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		if string(buf) != "hello" {
+			t.Errorf("Expected hello, got %s", buf)
+		}
+	})
+
+	t.Run("OpenMissingFileFails", func(t *testing.T) {
+		s := newStorage()
+		if _, err := s.Open(FileDesc{Type: TypeSSTable, Num: 99}); err == nil {
+			t.Error("Expected an error opening a file that was never created")
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		s := newStorage()
+		for _, num := range []int{2, 0, 1} {
+			w, err := s.Create(FileDesc{Type: TypeSSTable, Num: num})
+			if err != nil {
+				t.Fatalf("Failed to create: %v", err)
+			}
+			w.Close()
+		}
+		if _, err := s.Create(FileDesc{Type: TypeLog, Num: 0}); err != nil {
+			t.Fatalf("Failed to create log file: %v", err)
+		}
+
+		fds, err := s.List(TypeSSTable)
+		if err != nil {
+			t.Fatalf("Failed to list: %v", err)
+		}
+		if len(fds) != 3 {
+			t.Fatalf("Expected 3 SSTable files, got %d", len(fds))
+		}
+		for i, fd := range fds {
+			if fd.Num != i {
+				t.Errorf("Expected files in ascending Num order, got %v", fds)
+			}
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		s := newStorage()
+		fd := FileDesc{Type: TypeSSTable, Num: 1}
+		w, _ := s.Create(fd)
+		w.Close()
+
+		if err := s.Remove(fd); err != nil {
+			t.Fatalf("Failed to remove: %v", err)
+		}
+		if _, err := s.Open(fd); err == nil {
+			t.Error("Expected an error opening a removed file")
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		s := newStorage()
+		oldfd := FileDesc{Type: TypeSSTable, Num: 1}
+		newfd := FileDesc{Type: TypeSSTable, Num: 2}
+
+		w, _ := s.Create(oldfd)
+		w.Write([]byte("data"))
+		w.Close()
+
+		if err := s.Rename(oldfd, newfd); err != nil {
+			t.Fatalf("Failed to rename: %v", err)
+		}
+		if _, err := s.Open(oldfd); err == nil {
+			t.Error("Expected old FileDesc to no longer exist")
+		}
+		r, err := s.Open(newfd)
+		if err != nil {
+			t.Fatalf("Failed to open renamed file: %v", err)
+		}
+		r.Close()
+	})
+
+	t.Run("LockPreventsSecondLock", func(t *testing.T) {
+		s := newStorage()
+		releaser, err := s.Lock()
+		if err != nil {
+			t.Fatalf("Failed to acquire lock: %v", err)
+		}
+		if _, err := s.Lock(); err == nil {
+			t.Error("Expected a second Lock to fail while the first is held")
+		}
+		if err := releaser.Release(); err != nil {
+			t.Fatalf("Failed to release lock: %v", err)
+		}
+		releaser2, err := s.Lock()
+		if err != nil {
+			t.Fatalf("Expected Lock to succeed after Release: %v", err)
+		}
+		releaser2.Release()
+	})
+
+	t.Run("GetMetaWithoutSetMetaFails", func(t *testing.T) {
+		s := newStorage()
+		if _, err := s.GetMeta(); err != ErrNoMeta {
+			t.Errorf("Expected ErrNoMeta, got %v", err)
+		}
+	})
+
+	t.Run("SetMetaThenGetMeta", func(t *testing.T) {
+		s := newStorage()
+		fd := FileDesc{Type: TypeManifest, Num: 3}
+		if err := s.SetMeta(fd); err != nil {
+			t.Fatalf("Failed to set meta: %v", err)
+		}
+		got, err := s.GetMeta()
+		if err != nil {
+			t.Fatalf("Failed to get meta: %v", err)
+		}
+		if got != fd {
+			t.Errorf("Expected %v, got %v", fd, got)
+		}
+	})
+
+	t.Run("AppendPreservesExistingContents", func(t *testing.T) {
+		s := newStorage()
+		fd := FileDesc{Type: TypeLog, Num: 1}
+
+		w, err := s.Append(fd)
+		if err != nil {
+			t.Fatalf("Failed to append to missing file: %v", err)
+		}
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Failed to close writer: %v", err)
+		}
+
+		w, err = s.Append(fd)
+		if err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		if _, err := w.Write([]byte("world")); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Failed to close writer: %v", err)
+		}
+
+		r, err := s.Open(fd)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer r.Close()
+
+		size, err := r.Size()
+		if err != nil {
+			t.Fatalf("Failed to get size: %v", err)
+		}
+		buf := make([]byte, size)
+		if _, err := r.ReadAt(buf, 0); err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+		if string(buf) != "helloworld" {
+			t.Errorf("Expected helloworld, got %s", buf)
+		}
+	})
+
+	t.Run("ReadAtPastEndReturnsEOF", func(t *testing.T) {
+		s := newStorage()
+		fd := FileDesc{Type: TypeSSTable, Num: 1}
+		w, _ := s.Create(fd)
+		w.Write([]byte("abc"))
+		w.Close()
+
+		r, err := s.Open(fd)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer r.Close()
+
+		buf := make([]byte, 3)
+		if _, err := r.ReadAt(buf, 10); err != io.EOF {
+			t.Errorf("Expected io.EOF, got %v", err)
+		}
+	})
+}
+
+func TestFileStorage(t *testing.T) {
+	testStorage(t, func() Storage {
+		s, err := NewFileStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to create FileStorage: %v", err)
+		}
+		return s
+	})
+}
+
+func TestMemStorage(t *testing.T) {
+	testStorage(t, func() Storage {
+		return NewMemStorage()
+	})
+}